@@ -55,6 +55,42 @@ func assertPointerOrPointerToSlice(t reflect.Type) (reflect.Type, bool) {
 	return t, t.Kind() == reflect.Slice
 }
 
+var dynamicMapType = reflect.TypeOf(map[string]any{})
+
+// checks if t is *map[string]any or *[]map[string]any
+func isPointerToDynamicMapOrSliceOfMaps(t reflect.Type) (ok bool, isSlice bool) {
+	if t.Kind() != reflect.Ptr {
+		return false, false
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Slice {
+		return t.Elem() == dynamicMapType, true
+	}
+	return t == dynamicMapType, false
+}
+
+func assertPointersToValues(t reflect.Type) {
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() == reflect.Slice && t.Elem().Elem().Kind() != reflect.Uint8 {
+		panic("pointer to value expected, multiple targets are only supported for single row reads")
+	}
+}
+
+// checks if t is *map[K]T or *map[K][]T, where T is a struct
+func isPointerToMapOfStructs(t reflect.Type) (st reflect.Type, mapOfSlices bool, ok bool) {
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Map {
+		return nil, false, false
+	}
+	st = t.Elem().Elem()
+	if st.Kind() == reflect.Slice {
+		mapOfSlices = true
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		panic("pointer to map of structs or map of slices of structs expected")
+	}
+	return st, mapOfSlices, true
+}
+
 func assertPointerToStructOrPointerToSliceOfStructs(t reflect.Type) (reflect.Type, bool) {
 	isSlice := false
 	if t.Kind() != reflect.Ptr {
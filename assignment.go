@@ -0,0 +1,21 @@
+package sqlbatch
+
+// Assignment is a single "column = value" pair of the UpdateWhere SET clause.
+type Assignment struct {
+	column string
+	args   []any // Expr arguments
+}
+
+// Set assigns a value to the column, value is formatted the same way as Expr
+// arguments.
+func Set(column string, v any) Assignment {
+	return Assignment{column: column, args: []any{"?", v}}
+}
+
+// SetExpr assigns an expression to the column, e.g. SetExpr("count", "count + ?", 1).
+func SetExpr(column string, args ...any) Assignment {
+	if len(args) == 0 {
+		panic("expression is required")
+	}
+	return Assignment{column: column, args: args}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"github.com/lib/pq"
 	"github.com/nsf/sqlbatch/helper"
+	"github.com/nsf/sqlbatch/util"
 	"reflect"
 	"strings"
 	"sync"
@@ -22,6 +23,10 @@ type Batch struct {
 	customFieldInterfaceResolver FieldInterfaceResolver
 	numUncommittedQs             int
 	numWriteStmts                int
+	purges                       []*PurgeBuilder
+	defaultSchema                string
+	namingStrategy               NamingStrategy
+	versionBumps                 []versionBump
 }
 
 func New() *Batch {
@@ -36,14 +41,20 @@ func writePrimaryKeysWhereCondition(si *StructInfo, ptr unsafe.Pointer, sb *stri
 		b.WriteString(" = ")
 		f.Interface.Write(ptr, b)
 	}
-	sb.WriteString(" RETURNING NOTHING")
 }
 
-func writeFieldValues(si *StructInfo, ptr unsafe.Pointer, sb *strings.Builder, now time.Time, insert bool) {
+func writeFieldNames(fields []*FieldInfo, sb *strings.Builder) {
+	fieldNamesWriter := helper.NewListWriter(sb)
+	for _, f := range fields {
+		fieldNamesWriter.WriteString(f.QuotedName)
+	}
+}
+
+func writeFieldValues(fields []*FieldInfo, ptr unsafe.Pointer, sb *strings.Builder, now time.Time, insert bool) {
 	fieldValuesWriter := helper.NewListWriter(sb)
-	for _, f := range si.Fields {
+	for _, f := range fields {
 		if f.IsCreated() || f.IsUpdated() {
-			setTime(&f, ptr, now)
+			setTime(f, ptr, now)
 		}
 		if insert && f.IsDefault() {
 			sb := fieldValuesWriter.Next()
@@ -54,11 +65,51 @@ func writeFieldValues(si *StructInfo, ptr unsafe.Pointer, sb *strings.Builder, n
 	}
 }
 
-func writeTableName(si *StructInfo, table string, sb *strings.Builder) {
+// table may be qualified, e.g. "schema.table"
+func (b *Batch) writeTableName(si *StructInfo, table string, sb *strings.Builder) {
 	if table == "" {
-		sb.WriteString(si.QuotedName)
+		sb.WriteString(b.quoteTableName(si.tableName()))
 	} else {
-		sb.WriteString(pq.QuoteIdentifier(table))
+		sb.WriteString(b.quoteTableName(parseTableName(table)))
+	}
+}
+
+func hasInsertOnlyFields(fields []*FieldInfo) bool {
+	for _, f := range fields {
+		if f.IsInsertOnly() {
+			return true
+		}
+	}
+	return false
+}
+
+// UPSERT overwrites all columns, when some of them are insert-only it's
+// emulated with INSERT ... ON CONFLICT (pk) DO UPDATE SET col = excluded.col
+func writeOnConflictUpdate(si *StructInfo, fields []*FieldInfo, sb *strings.Builder) {
+	assertHasPrimaryKeys(si)
+	sb.WriteString(" ON CONFLICT (")
+	pkWriter := helper.NewListWriter(sb)
+	for _, f := range si.PrimaryKeys {
+		pkWriter.WriteString(f.QuotedName)
+	}
+	sb.WriteString(")")
+	var sets []*FieldInfo
+	for _, f := range fields {
+		if !f.IsPrimaryKey() && !f.IsInsertOnly() {
+			sets = append(sets, f)
+		}
+	}
+	if len(sets) == 0 {
+		sb.WriteString(" DO NOTHING")
+		return
+	}
+	sb.WriteString(" DO UPDATE SET ")
+	setsWriter := helper.NewListWriter(sb)
+	for _, f := range sets {
+		b := setsWriter.Next()
+		b.WriteString(f.QuotedName)
+		b.WriteString(" = excluded.")
+		b.WriteString(f.QuotedName)
 	}
 }
 
@@ -86,6 +137,14 @@ func (b *Batch) customResolver() FieldInterfaceResolver {
 	return b.customFieldInterfaceResolver
 }
 
+func (b *Batch) structInfo(t reflect.Type) *StructInfo {
+	naming := b.namingStrategy
+	if naming == nil {
+		naming = defaultNaming
+	}
+	return GetStructInfoWithNaming(t, b.customResolver(), naming)
+}
+
 func (b *Batch) beginNextStmt() *strings.Builder {
 	b.numWriteStmts++
 	sb := &b.stmtBuilder
@@ -95,6 +154,27 @@ func (b *Batch) beginNextStmt() *strings.Builder {
 	return sb
 }
 
+func (b *Batch) runReadInto(ctx context.Context, conn QueryContexter, r *readInto) error {
+	rows, err := conn.QueryContext(ctx, r.stmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n, err := r.scan(rows)
+	if err != nil {
+		return err
+	}
+	if len(r.preloads) == 0 || n == 0 {
+		return nil
+	}
+	// release the connection before running follow-up queries
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	return b.preload(ctx, conn, r, n)
+}
+
 func (b *Batch) parallelQuery(ctx context.Context, conn QueryContexter) error {
 	var wg sync.WaitGroup
 	wg.Add(len(b.readIntos))
@@ -103,82 +183,8 @@ func (b *Batch) parallelQuery(ctx context.Context, conn QueryContexter) error {
 	for i, r := range b.readIntos {
 		i, r := i, r
 		go func() {
-			rows, err := conn.QueryContext(ctx, r.stmt)
-			if err != nil {
-				errors[i] = err
-				wg.Done()
-				return
-			}
-			defer rows.Close()
-
-			var numArgs int
-			if r.primitive {
-				numArgs = 1
-			} else {
-				numArgs = len(r.si.Fields)
-			}
-			ptrs := make([]any, numArgs)
-			if r.slice {
-				val := r.val.Elem() // get the slice itself
-				idx := 0
-				for {
-					gotNext := rows.Next()
-					if !gotNext {
-						break
-					}
-					if idx >= val.Cap() {
-						newCap := val.Cap() * 2
-						if idx >= newCap {
-							newCap = idx + 1
-						}
-						newSlice := reflect.MakeSlice(val.Type(), val.Len(), newCap)
-						reflect.Copy(newSlice, val)
-						val.Set(newSlice)
-					}
-					if idx >= val.Len() {
-						val.SetLen(idx + 1)
-					}
-					if r.primitive {
-						ptrs[0] = val.Index(idx).Addr().Interface()
-					} else {
-						ptr := unsafe.Pointer(val.Index(idx).Addr().Pointer())
-						for i, f := range r.si.Fields {
-							f.Interface.GetPtr(ptr, &ptrs[i])
-						}
-					}
-					if err := rows.Scan(ptrs...); err != nil {
-						errors[i] = err
-						wg.Done()
-						return
-					}
-					idx++
-				}
-				val.SetLen(idx)
-			} else {
-				hasValue := rows.Next()
-				if !hasValue {
-					if r.errp != nil {
-						*r.errp = ErrNotFound
-					}
-				} else {
-					if r.primitive {
-						ptrs[0] = r.val.Interface()
-					} else {
-						for i, f := range r.si.Fields {
-							f.Interface.GetPtr(r.ptr, &ptrs[i])
-						}
-					}
-					if err := rows.Scan(ptrs...); err != nil {
-						errors[i] = err
-						wg.Done()
-						return
-					}
-					for rows.Next() {
-						// skip all the extra rows for single item fetch
-					}
-				}
-			}
-			wg.Done()
+			defer wg.Done()
+			errors[i] = b.runReadInto(ctx, conn, &r)
 		}()
 	}
 	wg.Wait()
@@ -204,6 +210,20 @@ func (b *Batch) SetTimeNowFunc(f func() time.Time) *Batch {
 	return b
 }
 
+// SetDefaultSchema sets the schema used for all unqualified table names.
+func (b *Batch) SetDefaultSchema(schema string) *Batch {
+	b.defaultSchema = schema
+	return b
+}
+
+// SetNamingStrategy sets the strategy used to derive table and column names
+// from Go names, default is SnakeCaseNaming.
+func (b *Batch) SetNamingStrategy(naming NamingStrategy) *Batch {
+	assertComparableNaming(naming)
+	b.namingStrategy = naming
+	return b
+}
+
 func (b *Batch) SetCustomFieldInterfaceResolver(f FieldInterfaceResolver) *Batch {
 	b.customFieldInterfaceResolver = f
 	return b
@@ -215,94 +235,280 @@ func (b *Batch) Raw(args ...any) *Batch {
 	return b
 }
 
-func (b *Batch) Insert(v any) *Batch {
-	return b.InsertInto(v, "")
+func (b *Batch) Insert(v any, opts ...InsertOption) *Batch {
+	return b.InsertInto(v, "", opts...)
 }
 
-func (b *Batch) InsertInto(v any, table string) *Batch {
+func (b *Batch) InsertInto(v any, table string, opts ...InsertOption) *Batch {
+	o := makeInsertOptions(opts)
 	structVal := reflect.ValueOf(v)
 	t, isSlice := assertPointerToStructOrSliceOfStructs(structVal.Type())
 	if isSlice {
-		serter := bulkSerter{command: "INSERT", b: b}
+		serter := bulkSerter{command: "INSERT", table: table, opts: o, b: b}
 		serter.addMany(v)
 		return serter.commit()
 	}
 
 	ptr := unsafe.Pointer(structVal.Pointer())
-	si := GetStructInfo(t, b.customResolver())
+	si := b.structInfo(t)
 
 	sb := b.beginNextStmt()
+	fields := o.fields(si)
 	sb.WriteString("INSERT INTO ")
-	writeTableName(si, table, sb)
+	b.writeTableName(si, table, sb)
 	sb.WriteString(" (")
-	fieldNamesWriter := helper.NewListWriter(sb)
-	for _, f := range si.Fields {
-		fieldNamesWriter.WriteString(f.QuotedName)
-	}
+	writeFieldNames(fields, sb)
 	sb.WriteString(") VALUES (")
-	writeFieldValues(si, ptr, sb, b.timeNow(), true)
+	writeFieldValues(fields, ptr, sb, b.timeNow(), true)
 	sb.WriteString(") RETURNING NOTHING")
 	return b
 }
 
-func (b *Batch) Upsert(v any) *Batch {
-	return b.UpsertInto(v, "")
+func (b *Batch) Upsert(v any, opts ...InsertOption) *Batch {
+	return b.UpsertInto(v, "", opts...)
 }
 
-func (b *Batch) UpsertInto(v any, table string) *Batch {
+func (b *Batch) UpsertInto(v any, table string, opts ...InsertOption) *Batch {
+	o := makeInsertOptions(opts)
 	structVal := reflect.ValueOf(v)
 	t, isSlice := assertPointerToStructOrSliceOfStructs(structVal.Type())
 	if isSlice {
-		serter := bulkSerter{command: "UPSERT", b: b}
+		serter := bulkSerter{command: "UPSERT", table: table, opts: o, b: b}
 		serter.addMany(v)
 		return serter.commit()
 	}
 
 	ptr := unsafe.Pointer(structVal.Pointer())
-	si := GetStructInfo(t, b.customResolver())
+	si := b.structInfo(t)
 
 	sb := b.beginNextStmt()
-	sb.WriteString("UPSERT INTO ")
-	writeTableName(si, table, sb)
-	sb.WriteString(" (")
-	fieldNamesWriter := helper.NewListWriter(sb)
-	for _, f := range si.Fields {
-		fieldNamesWriter.WriteString(f.QuotedName)
+	fields := o.fields(si)
+	onConflict := hasInsertOnlyFields(fields)
+	if onConflict {
+		sb.WriteString("INSERT INTO ")
+	} else {
+		sb.WriteString("UPSERT INTO ")
 	}
+	b.writeTableName(si, table, sb)
+	sb.WriteString(" (")
+	writeFieldNames(fields, sb)
 	sb.WriteString(") VALUES (")
-	writeFieldValues(si, ptr, sb, b.timeNow(), false)
-	sb.WriteString(") RETURNING NOTHING")
+	writeFieldValues(fields, ptr, sb, b.timeNow(), false)
+	sb.WriteString(")")
+	if onConflict {
+		writeOnConflictUpdate(si, fields, sb)
+	}
+	sb.WriteString(" RETURNING NOTHING")
 	return b
 }
 
+// Update updates all non-primary key columns of the struct. For structs with a
+// "version" field, the update is guarded by the current version and the field
+// is incremented once Run succeeds.
 func (b *Batch) Update(v any) *Batch {
 	return b.UpdateInto(v, "")
 }
 
 func (b *Batch) UpdateInto(v any, table string) *Batch {
+	return b.update(v, table, func(*FieldInfo) bool { return true }, nil)
+}
+
+// UpdateGroup updates only the columns of the group (see `db:"group:foo"`),
+// "updated" fields are set as well.
+func (b *Batch) UpdateGroup(v any, group string) *Batch {
+	si := b.structInfo(assertPointerToStruct(reflect.TypeOf(v)))
+	assertHasGroup(si, group)
+	include := func(f *FieldInfo) bool { return f.Group == group }
+	assertHasUpdatableFields(si, include, "group "+group+" has no updatable columns")
+	return b.update(v, "", include, nil)
+}
+
+// UpdateFields updates only the listed columns, "updated" fields are set as well.
+func (b *Batch) UpdateFields(v any, names ...string) *Batch {
+	if len(names) == 0 {
+		panic("at least one field is required")
+	}
+	fields := b.updateFieldSet(v, names)
+	return b.update(v, "", func(f *FieldInfo) bool {
+		_, ok := fields[f]
+		return ok
+	}, nil)
+}
+
+// UpdateOmit updates all columns except the listed ones.
+func (b *Batch) UpdateOmit(v any, names ...string) *Batch {
+	fields := b.updateFieldSet(v, names)
+	include := func(f *FieldInfo) bool {
+		_, ok := fields[f]
+		return !ok
+	}
+	si := b.structInfo(assertPointerToStruct(reflect.TypeOf(v)))
+	assertHasUpdatableFields(si, include, "all columns were omitted")
+	return b.update(v, "", include, nil)
+}
+
+// panics unless include selects at least one column which can be updated
+// explicitly ("updated" and version fields don't count)
+func assertHasUpdatableFields(si *StructInfo, include func(f *FieldInfo) bool, msg string) {
+	for _, f := range si.NonPrimaryKeys {
+		if f.isUpdatable() && !f.IsVersion() && !f.IsUpdated() && include(f) {
+			return
+		}
+	}
+	panic(msg + " (in table: " + si.QuotedName + ")")
+}
+
+// validates column names for UpdateFields/UpdateOmit
+func (b *Batch) updateFieldSet(v any, names []string) map[*FieldInfo]struct{} {
+	si := b.structInfo(assertPointerToStruct(reflect.TypeOf(v)))
+	out := map[*FieldInfo]struct{}{}
+	for _, name := range names {
+		f := findFieldOrPanic(si, name)
+		if f.IsPrimaryKey() {
+			panic("primary key can't be updated: " + name)
+		}
+		if !f.isUpdatable() {
+			panic("readonly or insertonly field can't be updated: " + name)
+		}
+		if f.IsVersion() {
+			panic("version field is maintained automatically: " + name)
+		}
+		out[f] = struct{}{}
+	}
+	return out
+}
+
+// Writes UPDATE statement for non-primary key fields for which include returns
+// true, "updated" fields are always included. Optional guard writes extra
+// conditions (starting with " AND ") after the primary key ones. Version field
+// is checked and incremented in the database, the struct is updated by Run.
+func (b *Batch) update(v any, table string, include func(f *FieldInfo) bool, guard func(sb *strings.Builder)) *Batch {
 	structVal := reflect.ValueOf(v)
 	t := assertPointerToStruct(structVal.Type())
 
 	ptr := unsafe.Pointer(structVal.Pointer())
-	si := GetStructInfo(t, b.customResolver())
+	si := b.structInfo(t)
 	assertHasPrimaryKeys(si)
 
+	version := si.Version
+	empty := version == nil
+	for _, f := range si.NonPrimaryKeys {
+		if f.isUpdatable() && !f.IsVersion() && (f.IsUpdated() || include(f)) {
+			empty = false
+			break
+		}
+	}
+	if empty {
+		panic("nothing to update, all non-primary key columns are readonly, insertonly or excluded (in table: " + si.QuotedName + ")")
+	}
+
 	sb := b.beginNextStmt()
+	if version != nil {
+		sb.WriteString("WITH u AS (")
+	}
 	sb.WriteString("UPDATE ")
-	writeTableName(si, table, sb)
+	b.writeTableName(si, table, sb)
 	sb.WriteString(" SET ")
 	valsWriter := helper.NewListWriter(sb)
 	for _, f := range si.NonPrimaryKeys {
+		if !f.isUpdatable() || f.IsVersion() {
+			continue
+		}
 		if f.IsUpdated() {
 			setTime(f, ptr, b.timeNow())
+		} else if !include(f) {
+			continue
 		}
 		b := valsWriter.Next()
 		b.WriteString(f.QuotedName)
 		b.WriteString(" = ")
 		f.Interface.Write(ptr, b)
 	}
+	if version != nil {
+		valsWriter.Next()
+		sb.WriteString(version.QuotedName)
+		sb.WriteString(" = ")
+		sb.WriteString(version.QuotedName)
+		sb.WriteString(" + 1")
+	}
 	sb.WriteString(" WHERE ")
 	writePrimaryKeysWhereCondition(si, ptr, sb)
+	if version != nil {
+		sb.WriteString(" AND ")
+		sb.WriteString(version.QuotedName)
+		sb.WriteString(" = ")
+		b.writeExpectedVersion(versionBump{version, ptr}, sb)
+	}
+	if guard != nil {
+		guard(sb)
+	}
+	if version != nil {
+		writeStaleVersionCheck(b.numWriteStmts, sb)
+		b.versionBumps = append(b.versionBumps, versionBump{version, ptr})
+	} else {
+		sb.WriteString(" RETURNING NOTHING")
+	}
+	return b
+}
+
+// UpdateWhere updates all rows matching the query, table name must be provided
+// via QueryBuilder. When TableFromStruct is used, column names are validated and
+// the "updated" and "version" fields are maintained automatically.
+func (b *Batch) UpdateWhere(q *QueryBuilder, sets ...Assignment) *Batch {
+	if len(sets) == 0 {
+		panic("at least one assignment is required")
+	}
+	if !q.hasTable() {
+		panic("when using UpdateWhere, table name must be provided via QueryBuilder")
+	}
+	q.b.numUncommittedQs--
+	si := q.si
+
+	sb := b.beginNextStmt()
+	sb.WriteString("UPDATE ")
+	sb.WriteString(q.qualifiedTableName(si))
+	sb.WriteString(" SET ")
+	valsWriter := helper.NewListWriter(sb)
+	assigned := map[string]struct{}{}
+	for _, s := range sets {
+		name := quotedColumnName(s.column, si)
+		if si != nil {
+			f := findFieldOrPanic(si, s.column)
+			if !f.isUpdatable() {
+				panic("readonly or insertonly field can't be updated: " + s.column)
+			}
+			if f.IsVersion() {
+				panic("version field is maintained automatically: " + s.column)
+			}
+		}
+		assigned[name] = struct{}{}
+		valsWriter.Next()
+		sb.WriteString(name)
+		sb.WriteString(" = ")
+		var tmp strings.Builder
+		b.Expr(s.args...).WriteTo(&tmp)
+		resolveColumnRefs(tmp.String(), sb, si, "")
+	}
+	if si != nil {
+		for _, f := range si.NonPrimaryKeys {
+			if _, ok := assigned[f.QuotedName]; ok || !f.IsUpdated() || !f.isUpdatable() {
+				continue
+			}
+			valsWriter.Next()
+			sb.WriteString(f.QuotedName)
+			sb.WriteString(" = ")
+			util.AppendTime(sb, b.timeNow(), false)
+		}
+		if si.Version != nil {
+			// concurrent Update() of the same rows must fail as stale
+			valsWriter.Next()
+			sb.WriteString(si.Version.QuotedName)
+			sb.WriteString(" = ")
+			sb.WriteString(si.Version.QuotedName)
+			sb.WriteString(" + 1")
+		}
+	}
+	q.WriteTo(sb, si)
 	return b
 }
 
@@ -310,20 +516,49 @@ func (b *Batch) Delete(v any) *Batch {
 	return b.DeleteFrom(v, "")
 }
 
+// DeleteFrom deletes the struct (by primary keys) or rows matching the
+// QueryBuilder. Structs with a "deleted" field are soft deleted: the field is
+// set to the current time instead, use HardDeleteFrom to really delete them.
 func (b *Batch) DeleteFrom(v any, table string) *Batch {
+	return b.delete(v, table, true)
+}
+
+func (b *Batch) HardDelete(v any) *Batch {
+	return b.HardDeleteFrom(v, "")
+}
+
+// HardDeleteFrom is the same as DeleteFrom, but soft deletes are ignored.
+func (b *Batch) HardDeleteFrom(v any, table string) *Batch {
+	return b.delete(v, table, false)
+}
+
+func (b *Batch) delete(v any, table string, soft bool) *Batch {
 	if q, ok := v.(*QueryBuilder); ok {
 		if table == "" {
-			if q.quotedTable == "" {
+			if !q.hasTable() {
 				panic("when using Delete/DeleteFrom with QueryBuilder, table name must be provided via QueryBuilder or directly")
 			}
-			table = q.quotedTable
+			table = q.qualifiedTableName(nil)
 		} else {
-			table = pq.QuoteIdentifier(table)
+			table = b.quoteTableName(parseTableName(table))
 		}
+		// the query builder is committed by the DELETE statement
+		q.b.numUncommittedQs--
 		sb := b.beginNextStmt()
+		if soft && q.si != nil && q.si.SoftDelete != nil {
+			sb.WriteString("UPDATE ")
+			sb.WriteString(table)
+			sb.WriteString(" SET ")
+			sb.WriteString(q.si.SoftDelete.QuotedName)
+			sb.WriteString(" = ")
+			util.AppendTime(sb, b.timeNow(), false)
+			q.WriteTo(sb, q.si)
+			return b
+		}
+		q.includeSoftDeleted()
 		sb.WriteString("DELETE FROM ")
 		sb.WriteString(table)
-		q.WriteTo(sb, nil)
+		q.WriteTo(sb, q.si)
 		return b
 	}
 
@@ -331,14 +566,25 @@ func (b *Batch) DeleteFrom(v any, table string) *Batch {
 	t := assertPointerToStruct(structVal.Type())
 
 	ptr := unsafe.Pointer(structVal.Pointer())
-	si := GetStructInfo(t, b.customResolver())
+	si := b.structInfo(t)
 	assertHasPrimaryKeys(si)
 
 	sb := b.beginNextStmt()
-	sb.WriteString("DELETE FROM ")
-	writeTableName(si, table, sb)
+	if soft && si.SoftDelete != nil {
+		setTime(si.SoftDelete, ptr, b.timeNow())
+		sb.WriteString("UPDATE ")
+		b.writeTableName(si, table, sb)
+		sb.WriteString(" SET ")
+		sb.WriteString(si.SoftDelete.QuotedName)
+		sb.WriteString(" = ")
+		si.SoftDelete.Interface.Write(ptr, sb)
+	} else {
+		sb.WriteString("DELETE FROM ")
+		b.writeTableName(si, table, sb)
+	}
 	sb.WriteString(" WHERE ")
 	writePrimaryKeysWhereCondition(si, ptr, sb)
+	sb.WriteString(" RETURNING NOTHING")
 	return b
 }
 
@@ -368,10 +614,57 @@ func (b *Batch) Select(qs ...*QueryBuilder) *Batch {
 		var isSlice bool
 		var ri readInto
 
-		if q.fields != nil {
-			if q.quotedTable == "" {
+		if isDynamic, isSliceOfMaps := isPointerToDynamicMapOrSliceOfMaps(val.Type()); isDynamic {
+			if !q.rawDefined && !q.hasTable() {
+				panic("table must be specified explicitly when selecting into map[string]any")
+			}
+			isSlice = isSliceOfMaps
+			ri = readInto{
+				slice:   isSlice,
+				val:     val,
+				errp:    q.errp,
+				dynamic: true,
+			}
+		} else if st, mapOfSlices, ok := isPointerToMapOfStructs(val.Type()); ok {
+			isSlice = true
+			si = b.structInfo(st)
+			ri = readInto{
+				si:        si,
+				fields:    q.structFields(si),
+				val:       val,
+				errp:      q.errp,
+				keyField:  q.mapKeyField(si, val.Type().Elem().Key()),
+				mapSlices: mapOfSlices,
+			}
+			if !containsField(ri.fields, ri.keyField) {
+				panic("map key column must be selected: " + ri.keyField.Name)
+			}
+		} else if len(q.extraInto) > 0 {
+			if !q.rawDefined {
+				if !q.hasTable() {
+					panic("table must be specified explicitly when using Fields()")
+				}
+				if len(q.fields) != 1+len(q.extraInto) {
+					panic("number of Fields() must match the number of Into() targets")
+				}
+			}
+			assertPointersToValues(val.Type())
+			for _, v := range q.extraInto {
+				assertPointersToValues(reflect.TypeOf(v))
+			}
+			ri = readInto{
+				val:       val,
+				extra:     q.extraInto,
+				errp:      q.errp,
+				primitive: true,
+			}
+		} else if q.fields != nil {
+			if !q.hasTable() {
 				panic("table must be specified explicitly when using Fields()")
 			}
+			if len(q.fields) != 1 {
+				panic("single primitive target expects exactly one field, use Into(&a, &b, ...) for multiple columns")
+			}
 			_, isSlice = assertPointerOrPointerToSlice(val.Type())
 			ri = readInto{
 				slice:     isSlice,
@@ -382,27 +675,28 @@ func (b *Batch) Select(qs ...*QueryBuilder) *Batch {
 		} else {
 			var t reflect.Type
 			t, isSlice = assertPointerToStructOrPointerToSliceOfStructs(val.Type())
-			si = GetStructInfo(t, b.customResolver())
+			si = b.structInfo(t)
+			fields := q.structFields(si)
 			ri = readInto{
-				si:    si,
-				slice: isSlice,
-				ptr:   unsafe.Pointer(val.Pointer()),
-				val:   val,
-				errp:  q.errp,
+				si:       si,
+				fields:   fields,
+				slice:    isSlice,
+				ptr:      unsafe.Pointer(val.Pointer()),
+				val:      val,
+				errp:     q.errp,
+				preloads: q.relations(si, fields),
 			}
 		}
 
+		if len(q.preloads) != 0 && ri.preloads == nil {
+			panic("Preload() is only supported for struct and slice of structs targets")
+		}
+
 		var sb strings.Builder
-		if q.rawDefined {
-			q.writeRawTo(&sb, si)
-		} else {
-			sb.WriteString("SELECT ")
-			q.columns(&sb, si)
-			sb.WriteString(" FROM ")
-			sb.WriteString(q.quotedTableName(si))
+		if !q.rawDefined {
 			q.setImplicitLimit(isSlice)
-			q.WriteTo(&sb, si)
 		}
+		q.writeSelectTo(&sb, si)
 		ri.stmt = sb.String()
 
 		b.readIntos = append(b.readIntos, ri)
@@ -430,9 +724,16 @@ func (b *Batch) Run(ctx context.Context, conn ExecQueryContexter) error {
 	if b.numUncommittedQs > 0 {
 		panic("Batch has uncommitted query builders, only create query builders using QueryBuilder() if you end up committing it (using QueryBuilder.End() or Batch.Select())")
 	}
+	if len(b.purges) > 0 {
+		panic("Batch contains purges, use RunPurge() to execute them")
+	}
 	if b.numWriteStmts > 0 {
 		_, err := conn.ExecContext(ctx, b.String())
-		return err
+		if err != nil {
+			return staleVersionError(err)
+		}
+		b.applyVersionBumps()
+		return nil
 	} else {
 		return b.parallelQuery(ctx, conn)
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/lib/pq"
 	"math"
@@ -689,6 +690,21 @@ func TestQuery(t *testing.T) {
 		t.Logf("%v", out2)
 		t.Logf("%v", out3)
 	}
+	{
+		// partial selects don't leave stale values in unselected fields
+		out1 := TestQuery{ID: 5, A: 5, B: "stale"}
+		out2 := []TestQuery{{A: 5, B: "stale"}}
+		b := New()
+		b.Select(
+			b.QueryBuilder(&out1).Columns("id", "b").Where("id = ?", 2),
+			b.QueryBuilder(&out2).Omit("a", "c").Where("id = ?", 3),
+		)
+		if err := b.Run(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEquals(t, out1, TestQuery{ID: 2, B: "two"})
+		assertDeepEquals(t, out2, []TestQuery{{ID: 3, B: "three"}})
+	}
 }
 
 func TestArrayInWhereExpr(t *testing.T) {
@@ -909,6 +925,27 @@ func TestPrimitive(t *testing.T) {
 		}
 		assertDeepEquals(t, count, 0)
 	}
+
+	{
+		var min, max int
+		if err := New().QueryBuilder().TableFromStruct(&Foo{}).Fields("MIN(a)", "MAX(a)").Into(&min, &max).Run(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEquals(t, min, 1)
+		assertDeepEquals(t, max, 2)
+	}
+}
+
+func TestMultipleTargets(t *testing.T) {
+	type Foo struct {
+		A int
+		B int
+	}
+	var min, max int
+	b := New()
+	b.Select(b.QueryBuilder().TableFromStruct(&Foo{}).Fields("MIN(a)", "MAX(a)").Into(&min, &max))
+	b.Select(b.QueryBuilder().Raw("SELECT MIN(b), MAX(b) FROM foo").Into(&min, &max))
+	assertStringEquals(t, b.String(), `SELECT MIN(a), MAX(a) FROM "foo" LIMIT 1; SELECT MIN(b), MAX(b) FROM foo`)
 }
 
 func TestGenericField(t *testing.T) {
@@ -999,4 +1036,787 @@ func TestDeleteQueryBuilder(t *testing.T) {
 		b.Delete(b.QueryBuilder("mytable").Where("foo = ?", "bar"))
 		assertStringEquals(t, b.String(), `DELETE FROM "mytable" WHERE foo = 'bar'`)
 	}
+	{
+		// query builders used by deletes are committed, Run must not panic
+		b := New()
+		b.Delete(b.QueryBuilder("mytable").Where("foo = ?", "bar"))
+		b.DeleteFrom(b.QueryBuilder().Where("foo = ?", "baz"), "mytable")
+		b.HardDeleteFrom(b.QueryBuilder().Where("foo = ?", "qux"), "mytable")
+		if err := b.Run(context.Background(), &versionTestConn{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestColumnsOmit(t *testing.T) {
+	type Foo struct {
+		ID   int64 `db:"primary_key"`
+		Name string
+		Blob []byte
+	}
+	var out []Foo
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).Columns("id", "name"))
+		assertStringEquals(t, b.String(), `SELECT "id", "name" FROM "foo"`)
+	}
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).Omit("blob").Where("id > ?", 5))
+		assertStringEquals(t, b.String(), `SELECT "id", "name" FROM "foo" WHERE id > 5`)
+	}
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).Prefix("t").Columns("name").Raw(`SELECT :columns: FROM :table:`))
+		assertStringEquals(t, b.String(), `SELECT t."name" FROM "foo" AS t`)
+	}
+}
+
+func TestDynamicMap(t *testing.T) {
+	var one map[string]any
+	var many []map[string]any
+	b := New()
+	b.Select(b.QueryBuilder(&one).Table("foo").Where("a = ?", 1))
+	b.Select(b.QueryBuilder(&many).Table("foo").Fields("a", "b"))
+	b.Select(b.QueryBuilder(&many).Raw("SELECT a, count(*) FROM foo GROUP BY a"))
+	assertStringEquals(t, b.String(), `SELECT * FROM "foo" WHERE a = 1 LIMIT 1; SELECT a, b FROM "foo"; SELECT a, count(*) FROM foo GROUP BY a`)
+}
+
+func TestDynamicMapQuery(t *testing.T) {
+	db := openTestDBConnection(t)
+	defer db.Close()
+
+	dbExec(t, db, `
+		DROP TABLE IF EXISTS "foo";
+		CREATE TABLE "foo" (
+			a INT NOT NULL,
+			b STRING NULL,
+			c DECIMAL NOT NULL,
+			d BYTES NOT NULL,
+			CONSTRAINT "primary" PRIMARY KEY (a ASC)
+		);
+		INSERT INTO "foo" VALUES (1, 'one', 1.5, '\x01'), (2, NULL, 2.5, '\x02');
+	`)
+
+	var one map[string]any
+	var many []map[string]any
+	b := New()
+	b.Select(b.QueryBuilder(&one).Table("foo").Where("a = ?", 1))
+	b.Select(b.QueryBuilder(&many).Raw("SELECT a, b FROM foo ORDER BY a"))
+	if err := b.Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, one, map[string]any{"a": int64(1), "b": "one", "c": "1.5", "d": []byte{1}})
+	assertDeepEquals(t, many, []map[string]any{{"a": int64(1), "b": "one"}, {"a": int64(2), "b": nil}})
+}
+
+func TestDistinct(t *testing.T) {
+	type Event struct {
+		ID        int64 `db:"primary_key"`
+		Key       string
+		CreatedAt time.Time
+	}
+	var out []Event
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).Distinct())
+		assertStringEquals(t, b.String(), `SELECT DISTINCT "id", "key", "created_at" FROM "event"`)
+	}
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).DistinctOn("key").OrderBy("key", true).OrderBy("created_at", false))
+		assertStringEquals(t, b.String(), `SELECT DISTINCT ON ("key") "id", "key", "created_at" FROM "event" ORDER BY "key" ASC, "created_at" DESC`)
+	}
+	assertPanics(t, func() {
+		b := New()
+		b.Select(b.QueryBuilder(&out).DistinctOn("key").OrderBy("created_at", false))
+	})
+}
+
+func TestOrderByExpr(t *testing.T) {
+	type Item struct {
+		ID        int64 `db:"primary_key"`
+		Name      string
+		Tags      []string
+		CreatedAt pq.NullTime
+	}
+	var out []Item
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).
+			OrderByExpr(b.Expr("lower(name)"), true, NullsDefault).
+			OrderByExpr(b.Expr("array_length(tags, ?)", 1), false, NullsLast).
+			OrderByNulls("created_at", true, NullsFirst))
+		assertStringEquals(t, b.String(), `SELECT "id", "name", "tags", "created_at" FROM "item" ORDER BY lower(name) ASC, array_length(tags, 1) DESC NULLS LAST, "created_at" ASC NULLS FIRST`)
+	}
+	{
+		b := New()
+		q := b.QueryBuilder(&out)
+		if err := q.OrderBySpec("name, -created_at"); err != nil {
+			t.Fatal(err)
+		}
+		b.Select(q)
+		assertStringEquals(t, b.String(), `SELECT "id", "name", "tags", "created_at" FROM "item" ORDER BY "name" ASC, "created_at" DESC`)
+	}
+	{
+		b := New()
+		q := b.QueryBuilder(&out)
+		if err := q.OrderBySpec("name,-password"); err == nil {
+			t.Errorf("error expected for unknown sort field")
+		}
+		if err := q.OrderBySpec("name,,id"); err == nil {
+			t.Errorf("error expected for empty sort field")
+		}
+		b.Select(q)
+		assertStringEquals(t, b.String(), `SELECT "id", "name", "tags", "created_at" FROM "item"`)
+	}
+}
+
+func TestQRawPlaceholders(t *testing.T) {
+	type Foo struct {
+		ID int64 `db:"primary_key"`
+		A  int
+	}
+	var out []Foo
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).
+			Where("a > ?", 5).
+			OrderBy("a", true).
+			Limit(10).
+			Raw(`SELECT :columns(f): FROM :table: AS f JOIN bar ON bar.foo_id = f.id WHERE :where: AND :cond: :order: :limit:`).
+			With("cond", "bar.x = ?", "y"))
+		assertStringEquals(t, b.String(), `SELECT f."id", f."a" FROM "foo" AS f JOIN bar ON bar.foo_id = f.id WHERE a > 5 AND bar.x = 'y' ORDER BY "a" ASC LIMIT 10`)
+	}
+	{
+		b := New()
+		b.Select(b.QueryBuilder(&out).Raw(`SELECT :pk:, data::jsonb::text, ':not_a_placeholder:' FROM :table: WHERE :where:`))
+		assertStringEquals(t, b.String(), `SELECT "id", data::jsonb::text, ':not_a_placeholder:' FROM "foo" WHERE TRUE`)
+	}
+	assertPanics(t, func() {
+		b := New()
+		b.Select(b.QueryBuilder(&out).Raw(`SELECT :columns: FROM :tabel:`))
+	})
+}
+
+func TestUpdateWhere(t *testing.T) {
+	type Task struct {
+		ID        int64 `db:"primary_key"`
+		Status    string
+		Count     int
+		UpdatedAt time.Time `db:"updated"`
+	}
+	{
+		b := New()
+		b.SetTimeNowFunc(func() time.Time { return rfc3339ToTime("2012-12-12T12:12:12Z") })
+		b.UpdateWhere(b.QueryBuilder().TableFromStruct(&Task{}).Where("status = ?", "done"),
+			Set("status", "archived"), SetExpr("count", "count + ?", 1))
+		assertStringEquals(t, b.String(), `UPDATE "task" SET "status" = 'archived', "count" = count + 1, "updated_at" = '2012-12-12 12:12:12' WHERE status = 'done'`)
+	}
+	{
+		b := New()
+		b.UpdateWhere(b.QueryBuilder("tasks").Where("id IN (?)", []int64{1, 2}), Set("status", nil))
+		assertStringEquals(t, b.String(), `UPDATE "tasks" SET "status" = NULL WHERE id IN (1, 2)`)
+	}
+	assertPanics(t, func() {
+		b := New()
+		b.UpdateWhere(b.QueryBuilder().TableFromStruct(&Task{}), Set("state", "archived"))
+	})
+}
+
+func TestMapTargets(t *testing.T) {
+	type Item struct {
+		ID      int64 `db:"primary_key"`
+		OrderID int64
+		Name    string
+	}
+	var byID map[int64]Item
+	var byOrder map[int64][]Item
+	b := New()
+	b.Select(b.QueryBuilder(&byID).Where("id > ?", 1))
+	b.Select(b.QueryBuilder(&byOrder).KeyBy("order_id").OrderBy("id", true))
+	assertStringEquals(t, b.String(), `SELECT "id", "order_id", "name" FROM "item" WHERE id > 1; SELECT "id", "order_id", "name" FROM "item" ORDER BY "id" ASC`)
+}
+
+func TestMapTargetsQuery(t *testing.T) {
+	db := openTestDBConnection(t)
+	defer db.Close()
+
+	dbExec(t, db, `
+		DROP TABLE IF EXISTS "item";
+		CREATE TABLE "item" (
+			id INT NOT NULL,
+			order_id INT NOT NULL,
+			name STRING NOT NULL,
+			CONSTRAINT "primary" PRIMARY KEY (id ASC)
+		);
+	`)
+
+	type Item struct {
+		ID      int64 `db:"primary_key"`
+		OrderID int64
+		Name    string
+	}
+
+	items := []Item{{1, 10, "a"}, {2, 10, "b"}, {3, 11, "c"}}
+	if err := New().Insert(items).Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	var byID map[int64]Item
+	var byOrder map[int64][]Item
+	b := New()
+	b.Select(b.QueryBuilder(&byID))
+	b.Select(b.QueryBuilder(&byOrder).KeyBy("order_id").OrderBy("id", true))
+	if err := b.Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, byID, map[int64]Item{1: items[0], 2: items[1], 3: items[2]})
+	assertDeepEquals(t, byOrder, map[int64][]Item{10: {items[0], items[1]}, 11: {items[2]}})
+	// running again into the same maps replaces their contents
+	if err := New().Delete(&items[0]).Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	b = New()
+	b.Select(b.QueryBuilder(&byID))
+	b.Select(b.QueryBuilder(&byOrder).KeyBy("order_id").OrderBy("id", true))
+	if err := b.Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, byID, map[int64]Item{2: items[1], 3: items[2]})
+	assertDeepEquals(t, byOrder, map[int64][]Item{10: {items[1]}, 11: {items[2]}})
+}
+
+type preloadUser struct {
+	ID   int64 `db:"primary_key"`
+	Name string
+}
+
+type preloadItem struct {
+	ID      int64 `db:"primary_key"`
+	OrderID int64
+	Name    string
+}
+
+type preloadOrder struct {
+	ID     int64 `db:"primary_key"`
+	UserID sql.NullInt64
+	Items  []preloadItem `db:"has_many:fk=order_id"`
+	User   *preloadUser  `db:"belongs_to:fk=user_id"`
+}
+
+func TestRelations(t *testing.T) {
+	si := GetStructInfo(reflect.TypeOf(preloadOrder{}), nil)
+	if len(si.Fields) != 2 {
+		t.Errorf("relations must not be columns, got %d fields", len(si.Fields))
+	}
+	items := si.FindRelation("Items")
+	if items == nil || items.Kind != RelationHasMany || items.ForeignKey != "order_id" || items.StructType() != reflect.TypeOf(preloadItem{}) {
+		t.Errorf("unexpected has_many relation: %+v", items)
+	}
+	user := si.FindRelation("User")
+	if user == nil || user.Kind != RelationBelongsTo || user.ForeignKey != "user_id" || user.StructType() != reflect.TypeOf(preloadUser{}) {
+		t.Errorf("unexpected belongs_to relation: %+v", user)
+	}
+
+	// parent key (primary key for has_many, foreign key for belongs_to) must be selected
+	var out []preloadOrder
+	b := New()
+	b.Select(b.QueryBuilder(&out).Columns("id").Preload("Items"))
+	for _, f := range []func(b *Batch) *QueryBuilder{
+		func(b *Batch) *QueryBuilder { return b.QueryBuilder(&out).Columns("user_id").Preload("Items") },
+		func(b *Batch) *QueryBuilder { return b.QueryBuilder(&out).Omit("user_id").Preload("User") },
+	} {
+		assertPanics(t, func() {
+			b := New()
+			b.Select(f(b))
+		})
+	}
+
+	// related side is validated by Select as well, not during Run
+	type Tag struct {
+		Name string
+	}
+	type Order struct {
+		ID     int64 `db:"primary_key"`
+		UserID int64
+		Items  []preloadItem `db:"has_many:fk=ordr_id"`
+		Tag    *Tag          `db:"belongs_to:fk=user_id"`
+	}
+	var orders []Order
+	for _, rel := range []string{"Items", "Tag"} {
+		assertPanics(t, func() {
+			b := New()
+			b.Select(b.QueryBuilder(&orders).Preload(rel))
+		})
+	}
+}
+
+func TestPreload(t *testing.T) {
+	db := openTestDBConnection(t)
+	defer db.Close()
+
+	dbExec(t, db, `
+		DROP TABLE IF EXISTS "preload_user";
+		CREATE TABLE "preload_user" (
+			id INT NOT NULL,
+			name STRING NOT NULL,
+			CONSTRAINT "primary" PRIMARY KEY (id ASC)
+		);
+		DROP TABLE IF EXISTS "preload_item";
+		CREATE TABLE "preload_item" (
+			id INT NOT NULL,
+			order_id INT NOT NULL,
+			name STRING NOT NULL,
+			CONSTRAINT "primary" PRIMARY KEY (id ASC)
+		);
+		DROP TABLE IF EXISTS "preload_order";
+		CREATE TABLE "preload_order" (
+			id INT NOT NULL,
+			user_id INT NULL,
+			CONSTRAINT "primary" PRIMARY KEY (id ASC)
+		);
+	`)
+
+	users := []preloadUser{{1, "one"}, {2, "two"}}
+	items := []preloadItem{{1, 1, "a"}, {2, 1, "b"}, {3, 2, "c"}}
+	b := New()
+	b.Insert(users)
+	b.Insert(items)
+	b.Insert(&preloadOrder{ID: 1, UserID: sql.NullInt64{Valid: true, Int64: 2}})
+	b.Insert(&preloadOrder{ID: 2})
+	if err := b.Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []preloadOrder
+	if err := New().QueryBuilder(&out).OrderBy("id", true).Preload("Items", "User").Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, len(out), 2)
+	assertDeepEquals(t, out[0].Items, items[:2])
+	assertDeepEquals(t, out[0].User, &users[1])
+	assertDeepEquals(t, out[1].Items, items[2:])
+	assertDeepEquals(t, out[1].User, (*preloadUser)(nil))
+}
+
+func TestColumnRefs(t *testing.T) {
+	type Base struct {
+		ID int64 `db:"primary_key"`
+	}
+	type User struct {
+		Base
+		EmailAddr string
+		Age       int
+	}
+	var u User
+	var out []User
+	b := New()
+	b.Select(b.QueryBuilder(&out).
+		Where("{EmailAddr} = ? AND name <> '{Age}'", "x").
+		Where("? >= ?", Col(&u, &u.Age), 18).
+		Where(Eq("{ID}", 5)).
+		OrderByExpr(b.Expr("lower({EmailAddr})"), true, NullsDefault))
+	assertStringEquals(t, b.String(), `SELECT "id", "email_addr", "age" FROM "user" WHERE "email_addr" = 'x' AND name <> '{Age}' AND "age" >= 18 AND "id" = 5 ORDER BY lower("email_addr") ASC`)
+
+	b = New()
+	b.Select(b.QueryBuilder(&out).Prefix("u").Raw("SELECT :columns: FROM :table: WHERE {Age} > ? AND :where:", 1).Where("{ID} = ?", Col(&u, &u.ID)))
+	assertStringEquals(t, b.String(), `SELECT u."id", u."email_addr", u."age" FROM "user" AS u WHERE u."age" > 1 AND u."id" = u."id"`)
+
+	b = New()
+	b.DeleteFrom(b.QueryBuilder().TableFromStruct(&u).Where("{EmailAddr} = ?", "x"), "")
+	b.HardDeleteFrom(b.QueryBuilder().TableFromStruct(&u).Where("{Age} < ?", 18), "old_user")
+	assertStringEquals(t, b.String(), `DELETE FROM "user" WHERE "email_addr" = 'x'; DELETE FROM "old_user" WHERE "age" < 18`)
+
+	b = New()
+	b.UpdateWhere(b.QueryBuilder().TableFromStruct(&u).Where("{Age} < ?", 18),
+		SetExpr("email_addr", "{EmailAddr} || ?", "{x}"), SetExpr("age", "{Age} + 1"))
+	assertStringEquals(t, b.String(), `UPDATE "user" SET "email_addr" = "email_addr" || '{x}', "age" = "age" + 1 WHERE "age" < 18`)
+
+	assertPanics(t, func() {
+		b := New()
+		b.Select(b.QueryBuilder(&out).Where("{Email} = ?", "x"))
+	})
+	assertPanics(t, func() {
+		b := New()
+		b.UpdateWhere(b.QueryBuilder("user"), SetExpr("age", "{Age} + 1"))
+	})
+}
+
+type namedTableFoo struct {
+	ID int64 `db:"primary_key"`
+}
+
+func (namedTableFoo) TableName() string { return "foos" }
+
+func TestTableNameOverride(t *testing.T) {
+	type Bar struct {
+		_  struct{} `db:"table:bars"`
+		ID int64    `db:"primary_key"`
+	}
+	b := New()
+	b.Insert(&namedTableFoo{ID: 1})
+	b.Upsert([]Bar{{ID: 1}, {ID: 2}})
+	b.InsertInto([]Bar{{ID: 3}}, "bars_archive")
+	b.Delete(&Bar{ID: 4})
+	assertStringEquals(t, b.String(), `INSERT INTO "foos" ("id") VALUES (1) RETURNING NOTHING; `+
+		`UPSERT INTO "bars" ("id") VALUES (1), (2) RETURNING NOTHING; `+
+		`INSERT INTO "bars_archive" ("id") VALUES (3) RETURNING NOTHING; `+
+		`DELETE FROM "bars" WHERE "id" = 4 RETURNING NOTHING`)
+
+	var out []namedTableFoo
+	b = New()
+	b.Select(b.QueryBuilder(&out), b.QueryBuilder().TableFromStruct(&Bar{}).Fields("id").Into(&[]int64{}))
+	assertStringEquals(t, b.String(), `SELECT "id" FROM "foos"; SELECT id FROM "bars"`)
+}
+
+type qualifiedNamerFoo struct {
+	ID int64 `db:"primary_key"`
+}
+
+func (qualifiedNamerFoo) TableName() string { return "audit.events" }
+
+func TestQualifiedTableNames(t *testing.T) {
+	type Account struct {
+		_  struct{} `db:"schema:billing"`
+		ID int64    `db:"primary_key"`
+	}
+	type Invoice struct {
+		_  struct{} `db:"table:billing.invoices"`
+		ID int64    `db:"primary_key"`
+	}
+	type Foo struct {
+		ID int64 `db:"primary_key"`
+	}
+	b := New()
+	b.Insert(&Invoice{ID: 1})
+	b.Delete(&qualifiedNamerFoo{ID: 2})
+	assertStringEquals(t, b.String(), `INSERT INTO "billing"."invoices" ("id") VALUES (1) RETURNING NOTHING; `+
+		`DELETE FROM "audit"."events" WHERE "id" = 2 RETURNING NOTHING`)
+
+	b = New()
+	b.Insert(&Account{ID: 1})
+	b.InsertInto(&Foo{ID: 2}, "my.schema.foo")
+	b.Delete(b.QueryBuilder().Table("db", "s", "foo").Where("id = ?", 3))
+	b.UpdateWhere(b.QueryBuilder().TableFromStruct(&Foo{}).Schema("archive").Where("id = ?", 4), SetExpr("id", "id + 1"))
+	assertStringEquals(t, b.String(), `INSERT INTO "billing"."account" ("id") VALUES (1) RETURNING NOTHING; `+
+		`INSERT INTO "my"."schema"."foo" ("id") VALUES (2) RETURNING NOTHING; `+
+		`DELETE FROM "db"."s"."foo" WHERE id = 3; `+
+		`UPDATE "archive"."foo" SET "id" = id + 1 WHERE id = 4`)
+
+	var out []Foo
+	var accounts []Account
+	b = New().SetDefaultSchema("tenant1")
+	b.Select(b.QueryBuilder(&out).Prefix("f"), b.QueryBuilder(&accounts), b.QueryBuilder().Table("other.foo").Fields("id").Into(&[]int64{}))
+	assertStringEquals(t, b.String(), `SELECT f."id" FROM "tenant1"."foo" AS f; SELECT "id" FROM "billing"."account"; SELECT id FROM "other"."foo"`)
+}
+
+type customGroupNaming struct {
+	SnakeCaseNaming
+}
+
+func (customGroupNaming) GroupColumnName(group, column string) string { return group + "_" + column }
+
+type mapNaming struct {
+	SnakeCaseNaming
+	tables map[string]string
+}
+
+func (n mapNaming) TableName(structName string) string {
+	if name, ok := n.tables[structName]; ok {
+		return name
+	}
+	return n.SnakeCaseNaming.TableName(structName)
+}
+
+func TestNamingStrategy(t *testing.T) {
+	type Address struct {
+		City string
+	}
+	type UserCategory struct {
+		UserID   int64 `db:"primary_key"`
+		FullName string
+		Legacy   string `db:"column:LEGACY"`
+		Address  `db:"group:home"`
+	}
+	v := &UserCategory{UserID: 1, FullName: "x", Legacy: "y", Address: Address{City: "z"}}
+	cases := []struct {
+		naming   NamingStrategy
+		expected string
+	}{
+		{nil, `INSERT INTO "user_category" ("user_id", "full_name", "LEGACY", "city") VALUES (1, 'x', 'y', 'z') RETURNING NOTHING`},
+		{CamelCaseNaming{}, `INSERT INTO "userCategory" ("userID", "fullName", "LEGACY", "city") VALUES (1, 'x', 'y', 'z') RETURNING NOTHING`},
+		{VerbatimNaming{}, `INSERT INTO "UserCategory" ("UserID", "FullName", "LEGACY", "City") VALUES (1, 'x', 'y', 'z') RETURNING NOTHING`},
+		{PluralNaming{SnakeCaseNaming{}}, `INSERT INTO "user_categories" ("user_id", "full_name", "LEGACY", "city") VALUES (1, 'x', 'y', 'z') RETURNING NOTHING`},
+		{customGroupNaming{}, `INSERT INTO "user_category" ("user_id", "full_name", "LEGACY", "home_city") VALUES (1, 'x', 'y', 'z') RETURNING NOTHING`},
+	}
+	for _, c := range cases {
+		b := New().SetNamingStrategy(c.naming)
+		b.Insert(v)
+		assertStringEquals(t, b.String(), c.expected)
+	}
+
+	var out []UserCategory
+	b := New().SetNamingStrategy(CamelCaseNaming{})
+	b.Select(b.QueryBuilder(&out).Where("{FullName} = ?", "x"))
+	assertStringEquals(t, b.String(), `SELECT "userID", "fullName", "LEGACY", "city" FROM "userCategory" WHERE "fullName" = 'x'`)
+
+	// non-comparable strategies can't be cache keys, pointers to them can
+	naming := mapNaming{tables: map[string]string{"UserCategory": "uc"}}
+	assertPanics(t, func() { New().SetNamingStrategy(naming) })
+	assertPanics(t, func() { GetStructInfoWithNaming(reflect.TypeOf(UserCategory{}), nil, naming) })
+	b = New().SetNamingStrategy(&naming)
+	b.Delete(v)
+	assertStringEquals(t, b.String(), `DELETE FROM "uc" WHERE "user_id" = 1 RETURNING NOTHING`)
+
+	assertStringEquals(t, pluralize("box"), "boxes")
+	assertStringEquals(t, pluralize("key"), "keys")
+}
+
+func TestGroups(t *testing.T) {
+	type Billing struct {
+		Plan    string
+		Balance int64
+	}
+	type Profile struct {
+		Bio string
+	}
+	type Account struct {
+		ID        int64 `db:"primary_key"`
+		Name      string
+		UpdatedAt time.Time `db:"updated"`
+		Billing   `db:"group:billing"`
+		Profile   `db:"group:profile"`
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := &Account{ID: 1, Name: "a", Billing: Billing{Plan: "pro", Balance: 10}, Profile: Profile{Bio: "b"}}
+
+	b := New().SetTimeNowFunc(func() time.Time { return now })
+	b.UpdateGroup(v, "billing")
+	b.Insert(v, SkipGroup("profile"))
+	b.Upsert([]Account{*v}, SkipGroup("billing"), SkipGroup("profile"))
+	assertStringEquals(t, b.String(), `UPDATE "account" SET "updated_at" = '2020-01-02 03:04:05', "plan" = 'pro', "balance" = 10 WHERE "id" = 1 RETURNING NOTHING; `+
+		`INSERT INTO "account" ("id", "name", "updated_at", "plan", "balance") VALUES (1, 'a', '2020-01-02 03:04:05', 'pro', 10) RETURNING NOTHING; `+
+		`UPSERT INTO "account" ("id", "name", "updated_at") VALUES (1, 'a', '2020-01-02 03:04:05') RETURNING NOTHING`)
+
+	var out []Account
+	b = New()
+	b.Select(b.QueryBuilder(&out).Group("profile"))
+	assertStringEquals(t, b.String(), `SELECT "id", "bio" FROM "account"`)
+
+	assertPanics(t, func() {
+		New().UpdateGroup(v, "nope")
+	})
+
+	type Audit struct {
+		CreatedBy string `db:"insertonly"`
+		Score     int64  `db:"readonly"`
+	}
+	type Doc struct {
+		ID    int64 `db:"primary_key"`
+		Title string
+		Audit `db:"group:audit"`
+	}
+	assertPanics(t, func() {
+		New().UpdateGroup(&Doc{ID: 1}, "audit")
+	})
+}
+
+func TestUpdateFields(t *testing.T) {
+	type Ticket struct {
+		ID        int64 `db:"primary_key"`
+		Status    string
+		Note      string
+		Blob      []byte
+		UpdatedAt time.Time `db:"updated"`
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := &Ticket{ID: 1, Status: "open", Note: "n", Blob: []byte{1}}
+	b := New().SetTimeNowFunc(func() time.Time { return now })
+	b.UpdateFields(v, "status", "note")
+	b.UpdateOmit(v, "blob")
+	assertStringEquals(t, b.String(), `UPDATE "ticket" SET "status" = 'open', "note" = 'n', "updated_at" = '2020-01-02 03:04:05' WHERE "id" = 1 RETURNING NOTHING; `+
+		`UPDATE "ticket" SET "status" = 'open', "note" = 'n', "updated_at" = '2020-01-02 03:04:05' WHERE "id" = 1 RETURNING NOTHING`)
+
+	for _, names := range [][]string{{"nope"}, {"id"}, {}} {
+		assertPanics(t, func() {
+			New().UpdateFields(v, names...)
+		})
+	}
+	assertPanics(t, func() {
+		New().UpdateOmit(v, "status", "note", "blob")
+	})
+}
+
+func TestUpdateChanged(t *testing.T) {
+	type Item struct {
+		ID        int64 `db:"primary_key"`
+		Name      string
+		Qty       int
+		Note      sql.NullString
+		UpdatedAt time.Time `db:"updated"`
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := Item{ID: 1, Name: "a", Qty: 1}
+	after := before
+	after.Qty = 2
+	after.Note = sql.NullString{String: "x", Valid: true}
+
+	b := New().SetTimeNowFunc(func() time.Time { return now })
+	b.UpdateChanged(&before, &before)
+	b.UpdateChanged(&before, &after)
+	b.UpdateChangedGuarded(&before, &after)
+	assertStringEquals(t, b.String(), `UPDATE "item" SET "qty" = 2, "note" = 'x', "updated_at" = '2020-01-02 03:04:05' WHERE "id" = 1 RETURNING NOTHING; `+
+		`UPDATE "item" SET "qty" = 2, "note" = 'x', "updated_at" = '2020-01-02 03:04:05' WHERE "id" = 1 AND "qty" = 1 AND "note" IS NULL RETURNING NOTHING`)
+
+	assertPanics(t, func() {
+		other := after
+		other.ID = 2
+		New().UpdateChanged(&before, &other)
+	})
+}
+
+func TestWriteRestrictedFields(t *testing.T) {
+	type Doc struct {
+		ID       int64  `db:"primary_key"`
+		TenantID string `db:"insertonly"`
+		Title    string
+		Total    int64 `db:"readonly"`
+		Revised  bool  `db:"noinsert"`
+	}
+	type Acc struct {
+		ID       int64  `db:"primary_key"`
+		TenantID string `db:"insertonly"`
+		Total    int64  `db:"readonly"`
+	}
+	v := &Doc{ID: 1, TenantID: "t", Title: "x", Total: 5, Revised: true}
+	b := New()
+	b.Insert(v)
+	b.Update(v)
+	b.Upsert(v)
+	b.Upsert([]Doc{*v, *v})
+	b.UpdateWhere(b.QueryBuilder().TableFromStruct(v).Where("id = ?", 1), Set("title", "y"))
+	assertStringEquals(t, b.String(), `INSERT INTO "doc" ("id", "tenant_id", "title") VALUES (1, 't', 'x') RETURNING NOTHING; `+
+		`UPDATE "doc" SET "title" = 'x', "revised" = TRUE WHERE "id" = 1 RETURNING NOTHING; `+
+		`INSERT INTO "doc" ("id", "tenant_id", "title") VALUES (1, 't', 'x') ON CONFLICT ("id") DO UPDATE SET "title" = excluded."title" RETURNING NOTHING; `+
+		`INSERT INTO "doc" ("id", "tenant_id", "title") VALUES (1, 't', 'x'), (1, 't', 'x') ON CONFLICT ("id") DO UPDATE SET "title" = excluded."title" RETURNING NOTHING; `+
+		`UPDATE "doc" SET "title" = 'y' WHERE id = 1`)
+
+	var out []Doc
+	b = New()
+	b.Select(b.QueryBuilder(&out))
+	assertStringEquals(t, b.String(), `SELECT "id", "tenant_id", "title", "total", "revised" FROM "doc"`)
+
+	for _, f := range []func(b *Batch){
+		func(b *Batch) { b.UpdateFields(v, "total") },
+		func(b *Batch) { b.UpdateFields(v, "tenant_id") },
+		func(b *Batch) { b.UpdateWhere(b.QueryBuilder().TableFromStruct(v), Set("total", 1)) },
+		func(b *Batch) { b.Update(&Acc{ID: 1}) },
+	} {
+		assertPanics(t, func() {
+			f(New())
+		})
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	type Post struct {
+		ID        int64 `db:"primary_key"`
+		Title     string
+		DeletedAt pq.NullTime `db:"deleted"`
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := &Post{ID: 1}
+	b := New().SetTimeNowFunc(func() time.Time { return now })
+	b.Delete(v)
+	b.HardDelete(v)
+	b.Delete(b.QueryBuilder().TableFromStruct(v).Where("title = ?", "x"))
+	b.HardDelete(b.QueryBuilder().TableFromStruct(v).Where("title = ?", "x"))
+	assertStringEquals(t, b.String(), `UPDATE "post" SET "deleted_at" = '2020-01-02 03:04:05' WHERE "id" = 1 RETURNING NOTHING; `+
+		`DELETE FROM "post" WHERE "id" = 1 RETURNING NOTHING; `+
+		`UPDATE "post" SET "deleted_at" = '2020-01-02 03:04:05' WHERE title = 'x' AND "deleted_at" IS NULL; `+
+		`DELETE FROM "post" WHERE title = 'x'`)
+	assertDeepEquals(t, v.DeletedAt, pq.NullTime{Time: now, Valid: true})
+
+	var out []Post
+	b = New()
+	b.Select(
+		b.QueryBuilder(&out),
+		b.QueryBuilder(&out).Prefix("p").Where("title = ?", "x"),
+		b.QueryBuilder(&out).WithDeleted(),
+		b.QueryBuilder(&out).OnlyDeleted(),
+		b.QueryBuilder(&out).Raw("SELECT :columns: FROM :table: WHERE :where:"),
+	)
+	assertStringEquals(t, b.String(), `SELECT "id", "title", "deleted_at" FROM "post" WHERE "deleted_at" IS NULL; `+
+		`SELECT p."id", p."title", p."deleted_at" FROM "post" AS p WHERE title = 'x' AND p."deleted_at" IS NULL; `+
+		`SELECT "id", "title", "deleted_at" FROM "post"; `+
+		`SELECT "id", "title", "deleted_at" FROM "post" WHERE "deleted_at" IS NOT NULL; `+
+		`SELECT "id", "title", "deleted_at" FROM "post" WHERE "deleted_at" IS NULL`)
+
+	var n int64
+	var row map[string]any
+	b = New()
+	b.Select(
+		b.QueryBuilder().TableFromStruct(v).Fields("count(*)").Into(&n),
+		b.QueryBuilder().TableFromStruct(v).Where("id = ?", 1).Into(&row),
+	)
+	assertStringEquals(t, b.String(), `SELECT count(*) FROM "post" WHERE "deleted_at" IS NULL LIMIT 1; `+
+		`SELECT * FROM "post" WHERE id = 1 AND "deleted_at" IS NULL LIMIT 1`)
+
+	assertPanics(t, func() {
+		type Bad struct {
+			ID        int64     `db:"primary_key"`
+			DeletedAt time.Time `db:"deleted"`
+		}
+		New().Delete(&Bad{})
+	})
+}
+
+func TestVersionDB(t *testing.T) {
+	db := openTestDBConnection(t)
+	defer db.Close()
+
+	dbExec(t, db, `
+		DROP TABLE IF EXISTS "version_account";
+		CREATE TABLE "version_account" (
+			id INT NOT NULL,
+			balance INT NOT NULL,
+			version INT NOT NULL,
+			CONSTRAINT "primary" PRIMARY KEY (id ASC)
+		);
+	`)
+
+	type VersionAccount struct {
+		ID      int64 `db:"primary_key"`
+		Balance int64
+		Version int64 `db:"version"`
+	}
+	v := &VersionAccount{ID: 1, Balance: 10}
+	if err := New().Insert(v).Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	stale := *v
+
+	// two updates of the same struct in one batch
+	v.Balance = 20
+	b := New()
+	b.Update(v)
+	b.Update(v)
+	if err := b.Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, v.Version, int64(2))
+
+	stale.Balance = 30
+	err := New().Update(&stale).Run(context.Background(), db)
+	if !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("ErrStaleVersion expected, got: %v", err)
+	}
+	assertDeepEquals(t, stale.Version, int64(0))
+
+	var out VersionAccount
+	if err := New().QueryBuilder(&out).Where("id = ?", 1).Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, out, VersionAccount{ID: 1, Balance: 20, Version: 2})
 }
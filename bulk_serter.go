@@ -1,7 +1,6 @@
 package sqlbatch
 
 import (
-	"github.com/nsf/sqlbatch/helper"
 	"reflect"
 	"strings"
 	"unsafe"
@@ -9,22 +8,29 @@ import (
 
 // Bulk (in)serter or (up)serter
 type bulkSerter struct {
-	command  string // INSERT or UPSERT
-	builder  strings.Builder
-	si       *StructInfo
-	b        *Batch
-	nonEmpty bool
+	command string // INSERT or UPSERT
+	table   string // overrides the struct table name if not empty
+	opts    insertOptions
+	fields  []*FieldInfo
+	// UPSERT with insert-only fields, see writeOnConflictUpdate
+	onConflict bool
+	builder    strings.Builder
+	si         *StructInfo
+	b          *Batch
+	nonEmpty   bool
 }
 
 func (b *bulkSerter) writeHeader() {
 	sb := &b.builder
-	sb.WriteString(b.command + " INTO ")
-	sb.WriteString(b.si.QuotedName)
-	sb.WriteString(" (")
-	fieldNamesWriter := helper.NewListWriter(sb)
-	for _, f := range b.si.Fields {
-		fieldNamesWriter.WriteString(f.QuotedName)
+	command := b.command
+	if command == "UPSERT" && hasInsertOnlyFields(b.fields) {
+		command = "INSERT"
+		b.onConflict = true
 	}
+	sb.WriteString(command + " INTO ")
+	b.b.writeTableName(b.si, b.table, sb)
+	sb.WriteString(" (")
+	writeFieldNames(b.fields, sb)
 	sb.WriteString(") VALUES ")
 }
 
@@ -40,7 +46,7 @@ func (b *bulkSerter) addMany(v any) *bulkSerter {
 	structSize := t.Size()
 
 	ptr := unsafe.Pointer(sliceVal.Pointer())
-	si := GetStructInfo(t, b.b.customFieldInterfaceResolver)
+	si := b.b.structInfo(t)
 
 	if b.si != nil && b.si != si {
 		panic("mismatching struct type on subsequent bulkSerter method calls")
@@ -49,6 +55,7 @@ func (b *bulkSerter) addMany(v any) *bulkSerter {
 	sb := &b.builder
 	if b.si == nil {
 		b.si = si
+		b.fields = b.opts.fields(si)
 		b.writeHeader()
 	} else {
 		sb.WriteString(", ")
@@ -57,7 +64,7 @@ func (b *bulkSerter) addMany(v any) *bulkSerter {
 	insert := b.command == "INSERT"
 	for i := 0; i < sliceLen; i++ {
 		sb.WriteString("(")
-		writeFieldValues(si, unsafe.Pointer(uintptr(ptr)+structSize*uintptr(i)), sb, b.b.timeNow(), insert)
+		writeFieldValues(b.fields, unsafe.Pointer(uintptr(ptr)+structSize*uintptr(i)), sb, b.b.timeNow(), insert)
 		sb.WriteString(")")
 		if i != sliceLen-1 {
 			sb.WriteString(", ")
@@ -70,6 +77,9 @@ func (b *bulkSerter) commit() *Batch {
 	if !b.nonEmpty {
 		return b.b
 	}
+	if b.onConflict {
+		writeOnConflictUpdate(b.si, b.fields, &b.builder)
+	}
 	b.builder.WriteString(" RETURNING NOTHING")
 
 	sb := b.b.beginNextStmt()
@@ -0,0 +1,104 @@
+package sqlbatch
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ColumnRef references a struct field by its Go name, it is written as
+// {GoName} and resolved to the quoted column name when the expression is
+// used in a QueryBuilder with a struct target.
+type ColumnRef string
+
+// Col makes a column reference from a pointer to struct and a pointer to one
+// of its fields, e.g. Col(&u, &u.Email). Both pointers must point to the same
+// struct value.
+func Col(structPtr, fieldPtr any) ColumnRef {
+	sv := reflect.ValueOf(structPtr)
+	assertPointerToStruct(sv.Type())
+	fv := reflect.ValueOf(fieldPtr)
+	if fv.Kind() != reflect.Pointer {
+		panic("pointer to struct field expected")
+	}
+	name := goFieldNameAt(sv.Type().Elem(), fv.Pointer()-sv.Pointer(), fv.Type().Elem())
+	if name == "" {
+		panic("pointer doesn't point to a field of the struct")
+	}
+	return ColumnRef("{" + name + "}")
+}
+
+// finds the name of the field (possibly in embedded structs) with the given
+// offset and type
+func goFieldNameAt(t reflect.Type, offset uintptr, ft reflect.Type) string {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if offset < f.Offset || offset >= f.Offset+f.Type.Size() {
+			continue
+		}
+		if offset == f.Offset && f.Type == ft {
+			return f.Name
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			return goFieldNameAt(f.Type, offset-f.Offset, ft)
+		}
+	}
+	return ""
+}
+
+func (si *StructInfo) findFieldByGoName(name string) *FieldInfo {
+	for i := range si.Fields {
+		f := &si.Fields[i]
+		if f.GoName == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// parses {GoName} reference at s[i], returns the end index or -1 if there is none
+func parseColumnRef(s string, i int) (name string, end int) {
+	j := i + 1
+	if j >= len(s) || !isNamedPlaceholderStartChar(s[j]) {
+		return "", -1
+	}
+	for j < len(s) && isNamedPlaceholderChar(s[j]) {
+		j++
+	}
+	if j == len(s) || s[j] != '}' {
+		return "", -1
+	}
+	return s[i+1 : j], j + 1
+}
+
+// Replaces {GoName} column references in s with quoted column names of si
+// fields and writes the result to sb. Panics on unknown fields.
+func resolveColumnRefs(s string, sb *strings.Builder, si *StructInfo, prefix string) {
+	last := 0
+	for i := 0; i < len(s); {
+		if j := skipNonCode(s, i); j != i {
+			i = j
+			continue
+		}
+		if s[i] != '{' {
+			i++
+			continue
+		}
+		name, end := parseColumnRef(s, i)
+		if end == -1 {
+			i++
+			continue
+		}
+		if si == nil {
+			panic("column reference {" + name + "} requires a struct target")
+		}
+		f := si.findFieldByGoName(name)
+		if f == nil {
+			panic("unknown field in column reference: {" + name + "}")
+		}
+		sb.WriteString(s[last:i])
+		sb.WriteString(prefixedName(prefix, f.QuotedName))
+		i = end
+		last = end
+	}
+	sb.WriteString(s[last:])
+}
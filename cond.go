@@ -0,0 +1,204 @@
+package sqlbatch
+
+import (
+	"github.com/lib/pq"
+	"github.com/nsf/sqlbatch/helper"
+	"reflect"
+	"strings"
+)
+
+type CondOp int
+
+const (
+	CondEq CondOp = iota + 1
+	CondIn
+	CondNotIn
+	CondBetween
+	CondIsNull
+	CondLike
+	CondAny
+	CondNot
+	CondAnd
+	CondOr
+)
+
+// Cond is a structured condition, unlike string expressions it quotes column
+// names and knows which columns are referenced. It's a tree which can be
+// inspected: leaf conditions have Column and Args, Not/And/Or have Children.
+// Cond can be used anywhere Expr arguments are accepted, e.g. Where(Eq("a", 1)).
+type Cond struct {
+	Op       CondOp
+	Column   string
+	Args     []any
+	Children []Cond
+}
+
+// Eq is "column = v", nil v results in "column IS NULL".
+func Eq(column string, v any) Cond {
+	if v == nil {
+		return IsNull(column)
+	}
+	return Cond{Op: CondEq, Column: column, Args: []any{v}}
+}
+
+// In is "column IN (values...)", values must be a slice. Empty slice results in FALSE.
+func In(column string, values any) Cond {
+	return Cond{Op: CondIn, Column: column, Args: sliceToArgs(values)}
+}
+
+// NotIn is "column NOT IN (values...)", values must be a slice. Empty slice results in TRUE.
+func NotIn(column string, values any) Cond {
+	return Cond{Op: CondNotIn, Column: column, Args: sliceToArgs(values)}
+}
+
+func Between(column string, from, to any) Cond {
+	return Cond{Op: CondBetween, Column: column, Args: []any{from, to}}
+}
+
+func IsNull(column string) Cond {
+	return Cond{Op: CondIsNull, Column: column}
+}
+
+func Like(column string, pattern string) Cond {
+	return Cond{Op: CondLike, Column: column, Args: []any{pattern}}
+}
+
+// Any is "column = ANY(ARRAY[values...])", values must be a slice. Empty slice results in FALSE.
+func Any(column string, values any) Cond {
+	return Cond{Op: CondAny, Column: column, Args: sliceToArgs(values)}
+}
+
+func Not(c Cond) Cond {
+	return Cond{Op: CondNot, Children: []Cond{c}}
+}
+
+func (c Cond) And(others ...Cond) Cond {
+	return Cond{Op: CondAnd, Children: append([]Cond{c}, others...)}
+}
+
+func (c Cond) Or(others ...Cond) Cond {
+	return Cond{Op: CondOr, Children: append([]Cond{c}, others...)}
+}
+
+// Columns returns all columns referenced by the condition, without duplicates.
+func (c Cond) Columns() []string {
+	var out []string
+	seen := map[string]struct{}{}
+	var walk func(c Cond)
+	walk = func(c Cond) {
+		if c.Column != "" {
+			if _, ok := seen[c.Column]; !ok {
+				seen[c.Column] = struct{}{}
+				out = append(out, c.Column)
+			}
+		}
+		for _, cc := range c.Children {
+			walk(cc)
+		}
+	}
+	walk(c)
+	return out
+}
+
+// untyped nil is an empty list
+func sliceToArgs(values any) []any {
+	if values == nil {
+		return nil
+	}
+	val := reflect.ValueOf(values)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		panic("slice expected, got: " + reflect.TypeOf(values).String())
+	}
+	out := make([]any, val.Len())
+	for i := range out {
+		out[i] = val.Index(i).Interface()
+	}
+	return out
+}
+
+// quotes column name, "t.col" is quoted as "t"."col"
+func quoteColumn(name string) string {
+	if _, end := parseColumnRef(name, 0); strings.HasPrefix(name, "{") && end == len(name) {
+		// {GoName} reference, resolved later
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+func (c Cond) writeTo(b *Batch, sb *strings.Builder) {
+	switch c.Op {
+	case CondEq:
+		sb.WriteString(quoteColumn(c.Column))
+		sb.WriteString(" = ")
+		b.writeArg(c.Args[0], sb)
+	case CondIn, CondNotIn:
+		if len(c.Args) == 0 {
+			if c.Op == CondIn {
+				sb.WriteString("FALSE")
+			} else {
+				sb.WriteString("TRUE")
+			}
+			return
+		}
+		sb.WriteString(quoteColumn(c.Column))
+		if c.Op == CondIn {
+			sb.WriteString(" IN (")
+		} else {
+			sb.WriteString(" NOT IN (")
+		}
+		b.writeArgList(c.Args, sb)
+		sb.WriteString(")")
+	case CondAny:
+		if len(c.Args) == 0 {
+			sb.WriteString("FALSE")
+			return
+		}
+		sb.WriteString(quoteColumn(c.Column))
+		sb.WriteString(" = ANY(ARRAY[")
+		b.writeArgList(c.Args, sb)
+		sb.WriteString("])")
+	case CondBetween:
+		sb.WriteString(quoteColumn(c.Column))
+		sb.WriteString(" BETWEEN ")
+		b.writeArg(c.Args[0], sb)
+		sb.WriteString(" AND ")
+		b.writeArg(c.Args[1], sb)
+	case CondIsNull:
+		sb.WriteString(quoteColumn(c.Column))
+		sb.WriteString(" IS NULL")
+	case CondLike:
+		sb.WriteString(quoteColumn(c.Column))
+		sb.WriteString(" LIKE ")
+		b.writeArg(c.Args[0], sb)
+	case CondNot:
+		sb.WriteString("NOT (")
+		c.Children[0].writeTo(b, sb)
+		sb.WriteString(")")
+	case CondAnd, CondOr:
+		sep := " AND "
+		if c.Op == CondOr {
+			sep = " OR "
+		}
+		sb.WriteString("(")
+		for i, cc := range c.Children {
+			if i != 0 {
+				sb.WriteString(sep)
+			}
+			cc.writeTo(b, sb)
+		}
+		sb.WriteString(")")
+	default:
+		panic("invalid condition")
+	}
+}
+
+func (b *Batch) writeArgList(args []any, sb *strings.Builder) {
+	w := helper.NewListWriter(sb)
+	for _, v := range args {
+		b.writeArg(v, w.Next())
+	}
+}
@@ -0,0 +1,46 @@
+package sqlbatch
+
+import (
+	"testing"
+)
+
+func TestCond(t *testing.T) {
+	b := New()
+	assertStringEquals(t, b.Expr(Eq("a", 1)).String(), `"a" = 1`)
+	assertStringEquals(t, b.Expr(Eq("t.a", nil)).String(), `"t"."a" IS NULL`)
+	assertStringEquals(t, b.Expr(In("a", []int{1, 2, 3})).String(), `"a" IN (1, 2, 3)`)
+	assertStringEquals(t, b.Expr(In("a", []string{})).String(), `FALSE`)
+	assertStringEquals(t, b.Expr(NotIn("a", []string{"x", "y"})).String(), `"a" NOT IN ('x', 'y')`)
+	assertStringEquals(t, b.Expr(NotIn("a", []int64(nil))).String(), `TRUE`)
+	assertStringEquals(t, b.Expr(In("a", nil)).String(), `FALSE`)
+	assertStringEquals(t, b.Expr(NotIn("a", nil)).String(), `TRUE`)
+	assertStringEquals(t, b.Expr(Between("a", 1, 10)).String(), `"a" BETWEEN 1 AND 10`)
+	assertStringEquals(t, b.Expr(Like("name", "foo%")).String(), `"name" LIKE 'foo%'`)
+	assertStringEquals(t, b.Expr(Any("tag", []string{"x"})).String(), `"tag" = ANY(ARRAY['x'])`)
+	assertStringEquals(t, b.Expr(Not(IsNull("a"))).String(), `NOT ("a" IS NULL)`)
+	assertStringEquals(t,
+		b.Expr(Eq("a", 1).And(Eq("b", 2), Eq("c", 3).Or(IsNull("c")))).String(),
+		`("a" = 1 AND "b" = 2 AND ("c" = 3 OR "c" IS NULL))`)
+	assertStringEquals(t,
+		b.Expr("x > ?", 5).And(In("a", []int{})).Or(Eq("b", "c")).String(),
+		`((x > 5 AND FALSE) OR "b" = 'c')`)
+}
+
+func TestCondTree(t *testing.T) {
+	c := Not(Eq("a", 1).Or(In("b", []int{1}), Eq("a", 2)))
+	assertDeepEquals(t, c.Op, CondNot)
+	assertDeepEquals(t, c.Children[0].Op, CondOr)
+	assertDeepEquals(t, c.Children[0].Children[1].Args, []any{1})
+	assertDeepEquals(t, c.Columns(), []string{"a", "b"})
+}
+
+func TestCondWhere(t *testing.T) {
+	type Foo struct {
+		A int
+		B string
+	}
+	var out []Foo
+	b := New()
+	b.Select(b.QueryBuilder(&out).Where(In("a", []int{1, 2})).Where(Not(Like("b", "x%"))))
+	assertStringEquals(t, b.String(), `SELECT "a", "b" FROM "foo" WHERE "a" IN (1, 2) AND NOT ("b" LIKE 'x%')`)
+}
@@ -2,7 +2,6 @@ package sqlbatch
 
 import (
 	"reflect"
-	"regexp"
 	"strings"
 )
 
@@ -26,8 +25,6 @@ type ExprBuilder struct {
 	root *expr
 }
 
-var placeholderRegexp = regexp.MustCompile(`\?`)
-
 func exprFromArgs(b *Batch, args ...any) *expr {
 	if len(args) == 0 {
 		panic("some argument is required")
@@ -35,37 +32,94 @@ func exprFromArgs(b *Batch, args ...any) *expr {
 	switch first := args[0].(type) {
 	case string:
 		if len(args) == 1 {
-			// just a string
+			// just a string, "?" is not a placeholder without args
+			return &expr{
+				kind: exprScalar,
+				val:  unescapePositional(first),
+			}
+		} else if named, ok := args[1].(NamedArgs); ok && len(args) == 2 {
+			// format with named args
 			return &expr{
 				kind: exprScalar,
-				val:  first,
+				val:  formatNamed(b, unescapePositional(first), named),
 			}
 		} else {
 			// format with args
-			numQ := strings.Count(first, "?")
-			if numQ != len(args)-1 {
-				panic("invalid number of arguments, number of arguments should match number of ? placeholders")
-			}
-			i := 0
-			rest := args[1:]
 			return &expr{
 				kind: exprScalar,
-				val: placeholderRegexp.ReplaceAllStringFunc(first, func(v string) string {
-					t := GetTypeInfo(reflect.TypeOf(rest[i]), b.customFieldInterfaceResolver)
-					var sb strings.Builder
-					t.Conv(rest[i], &sb)
-					i++
-					return sb.String()
-				}),
+				val:  formatPositional(b, first, args[1:]),
 			}
 		}
 	case ExprBuilder:
 		return first.root
+	case Cond:
+		if len(args) != 1 {
+			panic("Cond doesn't take arguments")
+		}
+		var sb strings.Builder
+		first.writeTo(b, &sb)
+		return &expr{
+			kind: exprScalar,
+			val:  sb.String(),
+		}
 	default:
 		panic("type not supported: " + reflect.TypeOf(args[0]).String())
 	}
 }
 
+// RawSQL is spliced into expressions verbatim (in parentheses) when used as
+// a placeholder argument.
+type RawSQL string
+
+// Raw wraps an SQL fragment, e.g. b.Expr("created_at < ?", sqlbatch.Raw("now()")).
+func Raw(s string) RawSQL {
+	return RawSQL(s)
+}
+
+// formats a single placeholder argument, ExprBuilder, Cond and RawSQL values
+// are spliced in as is and *QueryBuilder becomes a subquery
+func (b *Batch) writeArg(v any, sb *strings.Builder) {
+	switch val := v.(type) {
+	case nil:
+		sb.WriteString("NULL")
+		return
+	case ExprBuilder:
+		if val.IsEmpty() {
+			panic("empty ExprBuilder can't be used as an argument")
+		}
+		sb.WriteString("(")
+		val.WriteTo(sb)
+		sb.WriteString(")")
+		return
+	case Cond:
+		sb.WriteString("(")
+		val.writeTo(b, sb)
+		sb.WriteString(")")
+		return
+	case ColumnRef:
+		sb.WriteString(string(val))
+		return
+	case RawSQL:
+		sb.WriteString("(")
+		sb.WriteString(string(val))
+		sb.WriteString(")")
+		return
+	case *QueryBuilder:
+		// subquery is committed here, the same as with Select(), but only
+		// once, it may be formatted multiple times
+		if !val.subCommitted {
+			val.subCommitted = true
+			val.b.numUncommittedQs--
+		}
+		sb.WriteString("(")
+		val.writeSelectTo(sb, val.structInfo())
+		sb.WriteString(")")
+		return
+	}
+	t := GetTypeInfo(reflect.TypeOf(v), b.customFieldInterfaceResolver)
+	t.Conv(v, sb)
+}
+
 func (eb ExprBuilder) And(args ...any) ExprBuilder {
 	if eb.root == nil {
 		return ExprBuilder{b: eb.b, root: exprFromArgs(eb.b, args...)}
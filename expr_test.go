@@ -1,6 +1,9 @@
 package sqlbatch
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,3 +29,171 @@ func TestExprBuilder(t *testing.T) {
 		b.Expr("shop_id = ? AND id = ?", 5, 10).String(),
 		`shop_id = 5 AND id = 10`)
 }
+
+func TestExprNamed(t *testing.T) {
+	b := New()
+	assertStringEquals(t,
+		b.Expr("a = :a AND b > :min", Named{"a": 1, "min": 5}).String(),
+		"a = 1 AND b > 5")
+	assertStringEquals(t,
+		b.Expr("a = :a OR b = :a", Named{"a": "x"}).String(),
+		"a = 'x' OR b = 'x'")
+	assertStringEquals(t,
+		b.Expr("data::jsonb ? 'k' AND s = ':a' AND a = :a", Named{"a": nil}).String(),
+		"data::jsonb ? 'k' AND s = ':a' AND a = NULL")
+	assertStringEquals(t,
+		b.Expr("data = :a::jsonb AND n = :n::int", Named{"a": `{"k":1}`, "n": 1}).String(),
+		`data = '{"k":1}'::jsonb AND n = 1::int`)
+
+	type Foo struct {
+		ID   int64
+		Name string
+	}
+	foo := Foo{ID: 7, Name: "bar"}
+	assertStringEquals(t,
+		b.Expr("id = :id AND name <> :name", NamedFrom(&foo)).String(),
+		"id = 7 AND name <> 'bar'")
+
+	var out []Foo
+	b.Select(b.QueryBuilder(&out).Raw("SELECT :columns: FROM :table: WHERE id = :id", Named{"id": 1}))
+	assertStringEquals(t, b.String(), `SELECT "id", "name" FROM "foo" WHERE id = 1`)
+
+	for _, args := range [][]any{
+		{"a = :a", Named{}},
+		{"a = 1", Named{"a": 1}},
+		{"a = :missing", NamedFrom(&foo)},
+	} {
+		assertPanics(t, func() {
+			b.Expr(args...)
+		})
+	}
+}
+
+func TestExprPlaceholders(t *testing.T) {
+	b := New()
+	assertStringEquals(t,
+		b.Expr("a = ? AND b = '?' AND \"c?\" = ?", 1, 2).String(),
+		`a = 1 AND b = '?' AND "c?" = 2`)
+	assertStringEquals(t,
+		b.Expr("a = ? -- what?\nAND b = /* ? /* ? */ */ ?", 1, 2).String(),
+		"a = 1 -- what?\nAND b = /* ? /* ? */ */ 2")
+	assertStringEquals(t,
+		b.Expr(`a = E'it\'s?' AND b = $$?$$ AND c = $x$?$$?$x$ AND d = ?`, 1).String(),
+		`a = E'it\'s?' AND b = $$?$$ AND c = $x$?$$?$x$ AND d = 1`)
+	assertStringEquals(t,
+		b.Expr("data ?? ? AND data ?| array[?] AND data ?& array[?]", "k", "a", "b").String(),
+		`data ? 'k' AND data ?| array['a'] AND data ?& array['b']`)
+	assertStringEquals(t,
+		b.Expr("? || 'x'", "a").Or("x = ?||'y'", "b").String(),
+		`('a' || 'x' OR x = 'b'||'y')`)
+	assertStringEquals(t,
+		b.Expr("data ? 'k'").String(),
+		`data ? 'k'`)
+	assertStringEquals(t,
+		b.Expr("data ?? 'k' AND s = '??'").String(),
+		`data ? 'k' AND s = '??'`)
+	assertStringEquals(t,
+		b.Expr("data ?? :k", Named{"k": "a"}).String(),
+		`data ? 'a'`)
+	assertStringEquals(t,
+		b.Expr("a = :a -- :b\nAND s = $$:c$$", Named{"a": 1}).String(),
+		"a = 1 -- :b\nAND s = $$:c$$")
+
+	assertPanics(t, func() {
+		b.Expr("a = ? AND b = '?'", 1, 2)
+	})
+}
+
+type valuerID [4]byte
+
+func (id valuerID) Value() (driver.Value, error) {
+	return fmt.Sprintf("id-%x", id[:]), nil
+}
+
+type valuerDecimal struct {
+	v int64
+}
+
+func (d *valuerDecimal) Value() (driver.Value, error) {
+	return float64(d.v) / 100, nil
+}
+
+// named basic types implementing driver.Valuer
+type valuerUserID int64
+
+func (id valuerUserID) Value() (driver.Value, error) {
+	return fmt.Sprintf("u%d", id), nil
+}
+
+type valuerStatus string
+
+func (s valuerStatus) Value() (driver.Value, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return strings.ToUpper(string(s)), nil
+}
+
+func TestExprValuer(t *testing.T) {
+	b := New()
+	assertStringEquals(t,
+		b.Expr("id = ? AND price > ?", valuerID{1, 2, 3, 4}, valuerDecimal{150}).String(),
+		"id = 'id-01020304' AND price > 1.5")
+	assertStringEquals(t,
+		b.Expr("a = ? AND b = ?", (*valuerDecimal)(nil), &valuerDecimal{1}).String(),
+		"a = NULL AND b = 0.01")
+
+	type Foo struct {
+		ID    valuerID `db:"primary_key"`
+		Price valuerDecimal
+	}
+	b.Update(&Foo{ID: valuerID{0xff}, Price: valuerDecimal{200}})
+	assertStringEquals(t, b.String(), `UPDATE "foo" SET "price" = 2 WHERE "id" = 'id-ff000000' RETURNING NOTHING`)
+
+	b = New()
+	assertStringEquals(t,
+		b.Expr("user_id = ? AND status = ? AND s IS ?", valuerUserID(1), valuerStatus("active"), valuerStatus("")).String(),
+		"user_id = 'u1' AND status = 'ACTIVE' AND s IS NULL")
+
+	type Bar struct {
+		ID     valuerUserID `db:"primary_key"`
+		Status valuerStatus
+	}
+	b.Update(&Bar{ID: 7, Status: "inactive"})
+	assertStringEquals(t, b.String(), `UPDATE "bar" SET "status" = 'INACTIVE' WHERE "id" = 'u7' RETURNING NOTHING`)
+}
+
+func TestExprNested(t *testing.T) {
+	b := New()
+	active := b.Expr("active").And("deleted_at IS NULL")
+	assertStringEquals(t,
+		b.Expr("a = ? AND ?", 1, active).String(),
+		"a = 1 AND ((active AND deleted_at IS NULL))")
+	assertStringEquals(t,
+		b.Expr("created_at < ? AND ?", Raw("now()"), Eq("b", 2)).String(),
+		`created_at < (now()) AND ("b" = 2)`)
+	assertStringEquals(t,
+		b.Expr("a = :a OR :cond", Named{"a": 1, "cond": Raw("b > 2")}).String(),
+		"a = 1 OR (b > 2)")
+
+	type Foo struct {
+		ID    int64
+		BarID int64
+	}
+	type Bar struct {
+		ID   int64
+		Name string
+	}
+	var out []Foo
+	b.Select(b.QueryBuilder(&out).Where("bar_id IN ?",
+		b.QueryBuilder().TableFromStruct(&Bar{}).Fields("id").Where(Like("name", "x%"))))
+	assertStringEquals(t, b.String(), `SELECT "id", "bar_id" FROM "foo" WHERE bar_id IN (SELECT id FROM "bar" WHERE "name" LIKE 'x%')`)
+	assertDeepEquals(t, b.numUncommittedQs, 0)
+
+	// the same subquery used twice is committed once
+	b = New()
+	sub := b.QueryBuilder().TableFromStruct(&Bar{}).Fields("id")
+	b.Select(b.QueryBuilder(&out).Where("bar_id IN ?", sub).Where("id NOT IN ?", sub))
+	assertStringEquals(t, b.String(), `SELECT "id", "bar_id" FROM "foo" WHERE bar_id IN (SELECT id FROM "bar") AND id NOT IN (SELECT id FROM "bar")`)
+	assertDeepEquals(t, b.numUncommittedQs, 0)
+}
@@ -25,12 +25,19 @@ const (
 	FieldInfoIsPrimaryKey
 	FieldInfoIsNull
 	FieldInfoIsDefault
+	FieldInfoIsReadOnly
+	FieldInfoIsInsertOnly
+	FieldInfoIsNoInsert
+	FieldInfoIsDeleted
+	FieldInfoIsVersion
 )
 
 type FieldInfo struct {
 	flags      FieldInfoFlag
 	Name       string
 	QuotedName string
+	GoName     string
+	Offset     uintptr
 	Interface  FieldInterface
 	Group      string
 	Type       reflect.Type
@@ -41,3 +48,14 @@ func (f *FieldInfo) IsCreated() bool    { return f.flags&FieldInfoIsCreated != 0
 func (f *FieldInfo) IsUpdated() bool    { return f.flags&FieldInfoIsUpdated != 0 }
 func (f *FieldInfo) IsNull() bool       { return f.flags&FieldInfoIsNull != 0 }
 func (f *FieldInfo) IsDefault() bool    { return f.flags&FieldInfoIsDefault != 0 }
+func (f *FieldInfo) IsReadOnly() bool   { return f.flags&FieldInfoIsReadOnly != 0 }
+func (f *FieldInfo) IsInsertOnly() bool { return f.flags&FieldInfoIsInsertOnly != 0 }
+func (f *FieldInfo) IsNoInsert() bool   { return f.flags&FieldInfoIsNoInsert != 0 }
+func (f *FieldInfo) IsDeleted() bool    { return f.flags&FieldInfoIsDeleted != 0 }
+func (f *FieldInfo) IsVersion() bool    { return f.flags&FieldInfoIsVersion != 0 }
+
+// can the field be written by INSERT
+func (f *FieldInfo) isInsertable() bool { return !f.IsReadOnly() && !f.IsNoInsert() }
+
+// can the field be written by UPDATE
+func (f *FieldInfo) isUpdatable() bool { return !f.IsReadOnly() && !f.IsInsertOnly() }
@@ -0,0 +1,65 @@
+package sqlbatch
+
+func (si *StructInfo) hasGroup(group string) bool {
+	for i := range si.Fields {
+		if si.Fields[i].Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+func assertHasGroup(si *StructInfo, group string) {
+	if !si.hasGroup(group) {
+		panic("unknown group: " + group + " (in table: " + si.QuotedName + ")")
+	}
+}
+
+// returns fields of si for which keep returns true
+func filterFields(si *StructInfo, keep func(f *FieldInfo) bool) []*FieldInfo {
+	out := make([]*FieldInfo, 0, len(si.Fields))
+	for i := range si.Fields {
+		if f := &si.Fields[i]; keep(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+type insertOptions struct {
+	skipGroups []string
+}
+
+// InsertOption modifies Insert/Upsert statements.
+type InsertOption func(o *insertOptions)
+
+// SkipGroup excludes columns of the group (see `db:"group:foo"`) from the
+// statement, the database defaults are used for them on insert.
+func SkipGroup(group string) InsertOption {
+	return func(o *insertOptions) {
+		o.skipGroups = append(o.skipGroups, group)
+	}
+}
+
+func makeInsertOptions(opts []InsertOption) insertOptions {
+	var o insertOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// returns fields which are written by INSERT/UPSERT statement
+func (o *insertOptions) fields(si *StructInfo) []*FieldInfo {
+	skip := map[string]struct{}{}
+	for _, g := range o.skipGroups {
+		assertHasGroup(si, g)
+		skip[g] = struct{}{}
+	}
+	return filterFields(si, func(f *FieldInfo) bool {
+		if _, ok := skip[f.Group]; ok && f.Group != "" {
+			return false
+		}
+		return f.isInsertable()
+	})
+}
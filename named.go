@@ -0,0 +1,131 @@
+package sqlbatch
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// NamedArgs binds :name placeholders of Expr templates, see Named and NamedFrom.
+type NamedArgs interface {
+	writeNamed(b *Batch, name string, sb *strings.Builder) bool
+	// names which must be used by the template, nil if unused names are fine
+	requiredNames() []string
+}
+
+// Named binds :name placeholders to values, e.g.
+// b.Expr("a = :a AND b > :min", Named{"a": 1, "min": 5}). Values are formatted
+// the same way as positional arguments. Missing and unused names cause a panic.
+type Named map[string]any
+
+func (n Named) writeNamed(b *Batch, name string, sb *strings.Builder) bool {
+	v, ok := n[name]
+	if ok {
+		b.writeArg(v, sb)
+	}
+	return ok
+}
+
+func (n Named) requiredNames() []string {
+	out := make([]string, 0, len(n))
+	for k := range n {
+		out = append(out, k)
+	}
+	return out
+}
+
+type namedStruct struct {
+	val reflect.Value
+}
+
+// NamedFrom binds :name placeholders to the fields of the struct (by column
+// names, the same ones used in StructInfo), v must be a pointer to struct.
+// Missing names cause a panic, unused fields are fine.
+func NamedFrom(v any) NamedArgs {
+	val := reflect.ValueOf(v)
+	assertPointerToStruct(val.Type())
+	return namedStruct{val: val}
+}
+
+func (n namedStruct) writeNamed(b *Batch, name string, sb *strings.Builder) bool {
+	si := b.structInfo(n.val.Type().Elem())
+	f := si.FindField(name)
+	if f == nil {
+		return false
+	}
+	f.Interface.Write(unsafe.Pointer(n.val.Pointer()), sb)
+	return true
+}
+
+func (n namedStruct) requiredNames() []string {
+	return nil
+}
+
+func isNamedPlaceholderStartChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isNamedPlaceholderChar(c byte) bool {
+	return isNamedPlaceholderStartChar(c) || c >= '0' && c <= '9'
+}
+
+// parses :name placeholder at s[i], returns the end index or -1 if there is no
+// placeholder. Casts like "::jsonb" and Raw placeholders like :columns: are
+// not named placeholders, but a cast right after a placeholder (":a::jsonb")
+// is fine.
+func parseNamedPlaceholder(s string, i int) (name string, end int) {
+	if i > 0 && s[i-1] == ':' || i+1 >= len(s) || !isNamedPlaceholderStartChar(s[i+1]) {
+		return "", -1
+	}
+	j := i + 1
+	for j < len(s) && isNamedPlaceholderChar(s[j]) {
+		j++
+	}
+	if j < len(s) && (s[j] == '(' || s[j] == ':' && (j+1 == len(s) || s[j+1] != ':')) {
+		return "", -1
+	}
+	return s[i+1 : j], j
+}
+
+func formatNamed(b *Batch, s string, args NamedArgs) string {
+	var sb strings.Builder
+	used := map[string]struct{}{}
+	last := 0
+	for i := 0; i < len(s); {
+		if j := skipNonCode(s, i); j != i {
+			i = j
+			continue
+		}
+		switch s[i] {
+		case ':':
+			name, end := parseNamedPlaceholder(s, i)
+			if end == -1 {
+				i++
+				continue
+			}
+			sb.WriteString(s[last:i])
+			if !args.writeNamed(b, name, &sb) {
+				panic("missing named parameter: :" + name)
+			}
+			used[name] = struct{}{}
+			i = end
+			last = end
+		default:
+			i++
+		}
+	}
+	sb.WriteString(s[last:])
+
+	var unused []string
+	for _, name := range args.requiredNames() {
+		if _, ok := used[name]; !ok {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) != 0 {
+		sort.Strings(unused)
+		panic("unused named parameters: " + strings.Join(unused, ", "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,78 @@
+package sqlbatch
+
+import (
+	"github.com/codemodus/kace"
+	"reflect"
+	"strings"
+)
+
+// NamingStrategy maps Go names to table and column names. Explicit names
+// (TableNamer, "table:" and "column:" tags) are used as is. Implementations
+// are used as cache keys and must be comparable, e.g. a struct without map,
+// slice or func fields, or a pointer.
+type NamingStrategy interface {
+	// name of the table for the struct type name
+	TableName(structName string) string
+	// name of the column for the struct field name
+	ColumnName(fieldName string) string
+	// name of the column for the field of an embedded struct with a group tag
+	GroupColumnName(group, column string) string
+}
+
+// SnakeCaseNaming is the default strategy: "FooBar" becomes "foo_bar", groups
+// don't affect column names.
+type SnakeCaseNaming struct{}
+
+func (SnakeCaseNaming) TableName(structName string) string      { return kace.Snake(structName) }
+func (SnakeCaseNaming) ColumnName(fieldName string) string      { return kace.Snake(fieldName) }
+func (SnakeCaseNaming) GroupColumnName(_, column string) string { return column }
+
+// CamelCaseNaming makes "FooBar" into "fooBar".
+type CamelCaseNaming struct{}
+
+func (CamelCaseNaming) TableName(structName string) string      { return kace.Camel(structName) }
+func (CamelCaseNaming) ColumnName(fieldName string) string      { return kace.Camel(fieldName) }
+func (CamelCaseNaming) GroupColumnName(_, column string) string { return column }
+
+// VerbatimNaming uses Go names as is.
+type VerbatimNaming struct{}
+
+func (VerbatimNaming) TableName(structName string) string      { return structName }
+func (VerbatimNaming) ColumnName(fieldName string) string      { return fieldName }
+func (VerbatimNaming) GroupColumnName(_, column string) string { return column }
+
+// PluralNaming wraps another strategy and pluralizes table names using simple
+// english rules: "user" -> "users", "category" -> "categories", "box" -> "boxes".
+type PluralNaming struct {
+	NamingStrategy
+}
+
+func (n PluralNaming) TableName(structName string) string {
+	return pluralize(n.NamingStrategy.TableName(structName))
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiouAEIOU", c) != -1
+}
+
+func pluralize(s string) string {
+	switch {
+	case s == "":
+		return s
+	case strings.HasSuffix(s, "s"), strings.HasSuffix(s, "x"), strings.HasSuffix(s, "z"),
+		strings.HasSuffix(s, "ch"), strings.HasSuffix(s, "sh"):
+		return s + "es"
+	case len(s) > 1 && s[len(s)-1] == 'y' && !isVowel(s[len(s)-2]):
+		return s[:len(s)-1] + "ies"
+	default:
+		return s + "s"
+	}
+}
+
+var defaultNaming NamingStrategy = SnakeCaseNaming{}
+
+func assertComparableNaming(naming NamingStrategy) {
+	if naming != nil && !reflect.TypeOf(naming).Comparable() {
+		panic("naming strategy must be comparable, " + reflect.TypeOf(naming).String() + " is not (use a pointer)")
+	}
+}
@@ -0,0 +1,148 @@
+package sqlbatch
+
+import (
+	"context"
+	"github.com/nsf/sqlbatch/helper"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// returns pointers to the structs loaded by the readInto
+func (r *readInto) loadedStructs(n int) []unsafe.Pointer {
+	if !r.slice {
+		return []unsafe.Pointer{r.ptr}
+	}
+	val := r.val.Elem()
+	out := make([]unsafe.Pointer, n)
+	for i := range out {
+		out[i] = unsafe.Pointer(val.Index(i).Addr().Pointer())
+	}
+	return out
+}
+
+func singlePrimaryKey(si *StructInfo) *FieldInfo {
+	if len(si.PrimaryKeys) != 1 {
+		panic("relations require a single primary key (in table: " + si.QuotedName + ")")
+	}
+	return si.PrimaryKeys[0]
+}
+
+// field of the parent struct matched against the related rows: primary key for
+// has_many, foreign key for belongs_to
+func relationParentKey(si *StructInfo, rel *RelationInfo) *FieldInfo {
+	if rel.Kind == RelationHasMany {
+		return singlePrimaryKey(si)
+	}
+	return findFieldOrPanic(si, rel.ForeignKey)
+}
+
+// field of the related struct matched against the parent key: foreign key for
+// has_many, primary key for belongs_to
+func relationKey(relSI *StructInfo, rel *RelationInfo) *FieldInfo {
+	if rel.Kind == RelationHasMany {
+		return findFieldOrPanic(relSI, rel.ForeignKey)
+	}
+	return singlePrimaryKey(relSI)
+}
+
+// SQL literal of the field value, related rows are matched by it, which makes
+// matching independent of Go types used on both sides (e.g. int64 vs sql.NullInt64)
+func fieldLiteral(f *FieldInfo, ptr unsafe.Pointer) string {
+	var sb strings.Builder
+	f.Interface.Write(ptr, &sb)
+	return sb.String()
+}
+
+func (b *Batch) preload(ctx context.Context, conn QueryContexter, r *readInto, n int) error {
+	parents := r.loadedStructs(n)
+	for _, rel := range r.preloads {
+		if err := b.preloadRelation(ctx, conn, r.si, rel, parents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Batch) preloadRelation(ctx context.Context, conn QueryContexter, si *StructInfo, rel *RelationInfo, parents []unsafe.Pointer) error {
+	relSI := b.structInfo(rel.StructType())
+
+	// parentKey of the parent struct is matched against relKey of the related rows
+	parentKey := relationParentKey(si, rel)
+	relKey := relationKey(relSI, rel)
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	fieldNamesWriter := helper.NewListWriter(&sb)
+	fields := make([]*FieldInfo, len(relSI.Fields))
+	for i := range relSI.Fields {
+		fields[i] = &relSI.Fields[i]
+		fieldNamesWriter.WriteString(fields[i].QuotedName)
+	}
+	sb.WriteString(" FROM ")
+	sb.WriteString(b.quoteTableName(relSI.tableName()))
+	sb.WriteString(" WHERE ")
+	sb.WriteString(relKey.QuotedName)
+	sb.WriteString(" IN (")
+	keysWriter := helper.NewListWriter(&sb)
+	keys := map[string]struct{}{}
+	for _, p := range parents {
+		k := fieldLiteral(parentKey, p)
+		if _, ok := keys[k]; ok || k == "NULL" {
+			continue
+		}
+		keys[k] = struct{}{}
+		keysWriter.WriteString(k)
+	}
+	sb.WriteString(")")
+	if relSI.SoftDelete != nil {
+		sb.WriteString(" AND ")
+		sb.WriteString(relSI.SoftDelete.QuotedName)
+		sb.WriteString(" IS NULL")
+	}
+
+	related := reflect.New(reflect.SliceOf(rel.StructType()))
+	if len(keys) != 0 {
+		ri := readInto{
+			si:     relSI,
+			fields: fields,
+			slice:  true,
+			val:    related,
+			stmt:   sb.String(),
+		}
+		if err := b.runReadInto(ctx, conn, &ri); err != nil {
+			return err
+		}
+	}
+
+	groups := map[string]reflect.Value{}
+	rows := related.Elem()
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		k := fieldLiteral(relKey, unsafe.Pointer(row.Addr().Pointer()))
+		if rel.Kind == RelationHasMany {
+			g, ok := groups[k]
+			if !ok {
+				g = reflect.Zero(rel.Type)
+			}
+			groups[k] = reflect.Append(g, row)
+		} else {
+			groups[k] = row
+		}
+	}
+
+	for _, p := range parents {
+		field := reflect.NewAt(rel.Type, unsafe.Pointer(uintptr(p)+rel.Offset)).Elem()
+		g, ok := groups[fieldLiteral(parentKey, p)]
+		if !ok {
+			field.Set(reflect.Zero(rel.Type))
+		} else if rel.Type.Kind() == reflect.Ptr {
+			v := reflect.New(rel.StructType())
+			v.Elem().Set(g)
+			field.Set(v)
+		} else {
+			field.Set(g)
+		}
+	}
+	return nil
+}
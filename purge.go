@@ -0,0 +1,110 @@
+package sqlbatch
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// PurgeBuilder describes a large delete which is executed in rounds of
+// DELETE ... LIMIT n, until there is nothing left to delete. Each round is a
+// separate statement, which keeps transactions small.
+type PurgeBuilder struct {
+	stmt     string
+	pause    time.Duration
+	progress func(total int64)
+}
+
+// PurgeWhere deletes rows matching the query in batches of batchSize rows, table
+// name must be provided via QueryBuilder. Purges are executed by RunPurge.
+// Like HardDelete, it physically deletes soft deleted rows too, unless
+// OnlyDeleted() is used.
+func (b *Batch) PurgeWhere(q *QueryBuilder, batchSize int64) *PurgeBuilder {
+	if batchSize <= 0 {
+		panic("batch size must be positive")
+	}
+	if !q.hasTable() {
+		panic("when using PurgeWhere, table name must be provided via QueryBuilder")
+	}
+	q.b.numUncommittedQs--
+	q.Limit(batchSize)
+	q.includeSoftDeleted()
+
+	var sb strings.Builder
+	sb.WriteString("DELETE FROM ")
+	sb.WriteString(q.qualifiedTableName(q.si))
+	q.WriteTo(&sb, q.si)
+
+	p := &PurgeBuilder{stmt: sb.String()}
+	b.purges = append(b.purges, p)
+	return p
+}
+
+// Progress sets a callback which is called after each round with the total
+// number of rows deleted so far.
+func (p *PurgeBuilder) Progress(f func(total int64)) *PurgeBuilder {
+	p.progress = f
+	return p
+}
+
+// Pause sets a delay between rounds, to limit contention with other queries.
+func (p *PurgeBuilder) Pause(d time.Duration) *PurgeBuilder {
+	p.pause = d
+	return p
+}
+
+func (p *PurgeBuilder) String() string {
+	return p.stmt
+}
+
+func (p *PurgeBuilder) run(ctx context.Context, conn ExecContexter) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		res, err := conn.ExecContext(ctx, p.stmt)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if p.progress != nil {
+			p.progress(total)
+		}
+		if n == 0 {
+			return total, nil
+		}
+		if p.pause > 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(p.pause):
+			}
+		}
+	}
+}
+
+// RunPurge executes all purges defined via PurgeWhere one after another and
+// returns the total number of deleted rows. Purges can't be mixed with other
+// statements in the same Batch.
+func (b *Batch) RunPurge(ctx context.Context, conn ExecContexter) (int64, error) {
+	if b.numWriteStmts > 0 || len(b.readIntos) > 0 {
+		panic("Batch contains both purges and other statements, purges should be executed by a separate Batch")
+	}
+	if b.numUncommittedQs > 0 {
+		panic("Batch has uncommitted query builders, only create query builders using QueryBuilder() if you end up committing it (using QueryBuilder.End() or Batch.Select())")
+	}
+	var total int64
+	for _, p := range b.purges {
+		n, err := p.run(ctx, conn)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,61 @@
+package sqlbatch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/lib/pq"
+	"testing"
+)
+
+type purgeTestConn struct {
+	stmts    []string
+	affected []int64
+}
+
+func (c *purgeTestConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c.stmts = append(c.stmts, query)
+	n := c.affected[0]
+	c.affected = c.affected[1:]
+	return driver.RowsAffected(n), nil
+}
+
+func TestPurgeWhere(t *testing.T) {
+	conn := &purgeTestConn{affected: []int64{100, 100, 30, 0}}
+	var progress []int64
+	b := New()
+	b.PurgeWhere(b.QueryBuilder("events").Where("expires_at < ?", rfc3339ToTime("2012-12-12T12:12:12Z")), 100).
+		Progress(func(total int64) { progress = append(progress, total) })
+	total, err := b.RunPurge(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, total, int64(230))
+	assertDeepEquals(t, progress, []int64{100, 200, 230, 230})
+	assertDeepEquals(t, len(conn.stmts), 4)
+	assertStringEquals(t, conn.stmts[0], `DELETE FROM "events" WHERE expires_at < '2012-12-12 12:12:12' LIMIT 100`)
+}
+
+func TestPurgeWhereCancel(t *testing.T) {
+	conn := &purgeTestConn{affected: []int64{100, 100, 0}}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := New()
+	b.PurgeWhere(b.QueryBuilder("events"), 100).Progress(func(total int64) { cancel() })
+	total, err := b.RunPurge(ctx, conn)
+	if err != context.Canceled {
+		t.Errorf("context.Canceled expected, got: %v", err)
+	}
+	assertDeepEquals(t, total, int64(100))
+}
+
+func TestPurgeWhereSoftDeleted(t *testing.T) {
+	type Post struct {
+		ID        int64       `db:"primary_key"`
+		DeletedAt pq.NullTime `db:"deleted"`
+	}
+	b := New()
+	p1 := b.PurgeWhere(b.QueryBuilder().TableFromStruct(&Post{}).Where("id < ?", 5), 10)
+	p2 := b.PurgeWhere(b.QueryBuilder().TableFromStruct(&Post{}).OnlyDeleted(), 10)
+	assertStringEquals(t, p1.String(), `DELETE FROM "post" WHERE id < 5 LIMIT 10`)
+	assertStringEquals(t, p2.String(), `DELETE FROM "post" WHERE "deleted_at" IS NOT NULL LIMIT 10`)
+}
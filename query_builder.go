@@ -2,16 +2,37 @@ package sqlbatch
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/lib/pq"
 	"github.com/nsf/sqlbatch/helper"
 	"reflect"
-	"regexp"
 	"strings"
+	"time"
+)
+
+type Nulls int
+
+const (
+	NullsDefault Nulls = iota
+	NullsFirst
+	NullsLast
 )
 
 type orderByField struct {
 	field string
+	expr  ExprBuilder // if not empty, used instead of field
 	asc   bool
+	nulls Nulls
+}
+
+func (f *orderByField) quotedName(si *StructInfo, prefix string) string {
+	if !f.expr.IsEmpty() {
+		var sb strings.Builder
+		resolveColumnRefs(f.expr.String(), &sb, si, prefix)
+		return sb.String()
+	}
+	return quotedColumnName(f.field, si)
 }
 
 type QueryBuilder struct {
@@ -24,11 +45,24 @@ type QueryBuilder struct {
 	offsetDefined bool
 	orderByFields []orderByField
 	errp          *error
-	quotedTable   string
+	table         tableName
+	schema        string
 	raw           ExprBuilder
 	rawDefined    bool
 	prefix        string
 	fields        []string
+	columnNames   []string
+	omitNames     []string
+	group         string
+	deleted       softDeleteMode
+	extraInto     []any
+	distinct      bool
+	distinctOn    []string
+	si            *StructInfo // set by TableFromStruct
+	rawVars       map[string]ExprBuilder
+	keyBy         string
+	preloads      []string
+	subCommitted  bool // committed as a subquery, see writeArg
 }
 
 func (q *QueryBuilder) Prefix(prefix string) *QueryBuilder {
@@ -42,6 +76,19 @@ func (q *QueryBuilder) Raw(args ...any) *QueryBuilder {
 	return q
 }
 
+// With defines a custom Raw placeholder, e.g. With("cond", "a = ?", 5) makes
+// :cond: expand to "a = 5". Arguments are the same as for Where().
+func (q *QueryBuilder) With(name string, args ...any) *QueryBuilder {
+	if !isRawPlaceholderName(name) {
+		panic("invalid placeholder name: " + name)
+	}
+	if q.rawVars == nil {
+		q.rawVars = map[string]ExprBuilder{}
+	}
+	q.rawVars[name] = q.b.Expr(args...)
+	return q
+}
+
 func (q *QueryBuilder) setImplicitLimit(isSlice bool) {
 	if !isSlice {
 		q.limit = 1
@@ -49,26 +96,203 @@ func (q *QueryBuilder) setImplicitLimit(isSlice bool) {
 	}
 }
 
-func (q *QueryBuilder) Table(v string) *QueryBuilder {
-	q.quotedTable = pq.QuoteIdentifier(v)
+// Table sets the table name, it can be qualified: Table("s.t"), Table("s", "t")
+// or Table("db", "s", "t"), each part is quoted separately.
+func (q *QueryBuilder) Table(parts ...string) *QueryBuilder {
+	q.table = parseTableName(parts...)
 	return q
 }
 
+// Schema overrides the schema of the table.
+func (q *QueryBuilder) Schema(schema string) *QueryBuilder {
+	q.schema = schema
+	return q
+}
+
+func (q *QueryBuilder) hasTable() bool {
+	return q.table.name != ""
+}
+
 func (q *QueryBuilder) TableFromStruct(v any) *QueryBuilder {
 	val := reflect.ValueOf(v)
 	t, _ := assertPointerToStructOrPointerToSliceOfStructs(val.Type())
-	si := GetStructInfo(t, q.b.customResolver())
-	q.quotedTable = si.QuotedName
+	si := q.b.structInfo(t)
+	q.table = si.tableName()
+	q.si = si
 	return q
 }
 
+// returns StructInfo of the struct target or the one given to TableFromStruct,
+// nil if there is none
+func (q *QueryBuilder) structInfo() *StructInfo {
+	if q.si != nil {
+		return q.si
+	}
+	if q.into == nil {
+		return nil
+	}
+	t := reflect.TypeOf(q.into)
+	if t.Kind() != reflect.Ptr {
+		return nil
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isTypeNull(t) || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	return q.b.structInfo(t)
+}
+
 func (q *QueryBuilder) Fields(v ...string) *QueryBuilder {
 	q.fields = v
 	return q
 }
 
-func (q *QueryBuilder) Into(v any) *QueryBuilder {
-	q.into = v
+// Columns restricts the set of struct fields selected into a struct target.
+// Fields which are not listed keep their zero values.
+func (q *QueryBuilder) Columns(v ...string) *QueryBuilder {
+	q.columnNames = v
+	return q
+}
+
+// Omit is the inverse of Columns, all struct fields are selected except the
+// listed ones.
+func (q *QueryBuilder) Omit(v ...string) *QueryBuilder {
+	q.omitNames = v
+	return q
+}
+
+type softDeleteMode int
+
+const (
+	softDeleteExclude softDeleteMode = iota
+	softDeleteInclude
+	softDeleteOnly
+)
+
+// WithDeleted disables the implicit "deleted IS NULL" condition for structs
+// with soft deletes (see `db:"deleted"`).
+func (q *QueryBuilder) WithDeleted() *QueryBuilder {
+	q.deleted = softDeleteInclude
+	return q
+}
+
+// OnlyDeleted selects soft deleted rows only.
+func (q *QueryBuilder) OnlyDeleted() *QueryBuilder {
+	q.deleted = softDeleteOnly
+	return q
+}
+
+// implicit soft delete condition, empty if there is none, struct given to
+// TableFromStruct is used for targets which are not structs
+func (q *QueryBuilder) softDeleteCond(si *StructInfo) string {
+	if si == nil {
+		si = q.si
+	}
+	if si == nil || si.SoftDelete == nil {
+		return ""
+	}
+	name := prefixedName(q.prefix, si.SoftDelete.QuotedName)
+	switch q.deleted {
+	case softDeleteExclude:
+		return name + " IS NULL"
+	case softDeleteOnly:
+		return name + " IS NOT NULL"
+	}
+	return ""
+}
+
+// disables the implicit soft delete condition for physical deletes, explicit
+// OnlyDeleted() is kept
+func (q *QueryBuilder) includeSoftDeleted() {
+	if q.deleted == softDeleteExclude {
+		q.deleted = softDeleteInclude
+	}
+}
+
+func (q *QueryBuilder) hasWhere(si *StructInfo) bool {
+	return len(q.whereExprs) != 0 || q.softDeleteCond(si) != ""
+}
+
+// Group restricts the set of struct fields selected into a struct target to
+// the fields of the group (see `db:"group:foo"`) and primary keys.
+func (q *QueryBuilder) Group(group string) *QueryBuilder {
+	q.group = group
+	return q
+}
+
+// Preload fills has_many/belongs_to relation fields (by struct field name) of
+// the loaded structs, using follow-up queries executed right after the main one.
+func (q *QueryBuilder) Preload(relations ...string) *QueryBuilder {
+	q.preloads = append(q.preloads, relations...)
+	return q
+}
+
+// resolves preloaded relations, the parent key of each relation must be among
+// the selected fields. Both sides are validated here, preloads are executed in
+// a separate goroutine by Run, where panics can't be recovered.
+func (q *QueryBuilder) relations(si *StructInfo, fields []*FieldInfo) []*RelationInfo {
+	var out []*RelationInfo
+	for _, name := range q.preloads {
+		r := si.FindRelation(name)
+		if r == nil {
+			panic("unknown relation: " + name + " (in table: " + si.QuotedName + ")")
+		}
+		if key := relationParentKey(si, r); !containsField(fields, key) {
+			panic("relation " + name + " requires column " + key.Name + " to be selected (in table: " + si.QuotedName + ")")
+		}
+		relationKey(q.b.structInfo(r.StructType()), r)
+		out = append(out, r)
+	}
+	return out
+}
+
+// KeyBy sets the column used as a key when scanning into map[K]T or map[K][]T,
+// by default the single primary key is used.
+func (q *QueryBuilder) KeyBy(column string) *QueryBuilder {
+	q.keyBy = column
+	return q
+}
+
+func (q *QueryBuilder) mapKeyField(si *StructInfo, keyType reflect.Type) *FieldInfo {
+	var f *FieldInfo
+	if q.keyBy != "" {
+		f = findFieldOrPanic(si, q.keyBy)
+	} else {
+		if len(si.PrimaryKeys) != 1 {
+			panic("map target requires a single primary key or an explicit KeyBy() column (in table: " + si.QuotedName + ")")
+		}
+		f = si.PrimaryKeys[0]
+	}
+	if !f.Type.ConvertibleTo(keyType) {
+		panic("map key type " + keyType.String() + " doesn't match column " + f.Name + " of type " + f.Type.String())
+	}
+	return f
+}
+
+func containsField(fields []*FieldInfo, f *FieldInfo) bool {
+	for _, ff := range fields {
+		if ff == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Into sets the target of the query. Multiple targets can be used for reading
+// multiple columns of a single row, e.g. Fields("min(x)", "max(x)").Into(&a, &b),
+// in that case columns are scanned into targets by position.
+func (q *QueryBuilder) Into(v ...any) *QueryBuilder {
+	if len(v) == 0 {
+		panic("at least one target is required")
+	}
+	q.into = v[0]
+	q.extraInto = v[1:]
 	return q
 }
 
@@ -90,23 +314,96 @@ func (q *QueryBuilder) Offset(v int64) *QueryBuilder {
 }
 
 func (q *QueryBuilder) OrderBy(field string, asc bool) *QueryBuilder {
+	return q.OrderByNulls(field, asc, NullsDefault)
+}
+
+func (q *QueryBuilder) OrderByNulls(field string, asc bool, nulls Nulls) *QueryBuilder {
 	q.orderByFields = append(q.orderByFields, orderByField{
 		field: field,
 		asc:   asc,
+		nulls: nulls,
+	})
+	return q
+}
+
+// OrderByExpr orders by an arbitrary expression, e.g. b.Expr("lower(name)").
+func (q *QueryBuilder) OrderByExpr(e ExprBuilder, asc bool, nulls Nulls) *QueryBuilder {
+	if e.IsEmpty() {
+		panic("empty expression is not allowed in ORDER BY")
+	}
+	q.orderByFields = append(q.orderByFields, orderByField{
+		expr:  e,
+		asc:   asc,
+		nulls: nulls,
 	})
 	return q
 }
 
+// OrderBySpec parses a user supplied sort spec like "name,-created_at", where
+// "-" means descending order (and optional "+" means ascending). Only fields of
+// the struct target are allowed, anything else is reported as an error and
+// nothing is added to the query.
+func (q *QueryBuilder) OrderBySpec(spec string) error {
+	si := q.structInfo()
+	if si == nil {
+		return errors.New("sort spec requires a struct target")
+	}
+	var fields []orderByField
+	for _, v := range strings.Split(spec, ",") {
+		v = strings.TrimSpace(v)
+		asc := true
+		if strings.HasPrefix(v, "-") {
+			asc = false
+			v = v[1:]
+		} else if strings.HasPrefix(v, "+") {
+			v = v[1:]
+		}
+		if v == "" {
+			return fmt.Errorf("invalid sort spec: %q", spec)
+		}
+		if si.FindField(v) == nil {
+			return fmt.Errorf("unknown sort field: %q", v)
+		}
+		fields = append(fields, orderByField{field: v, asc: asc})
+	}
+	q.orderByFields = append(q.orderByFields, fields...)
+	return nil
+}
+
+func (q *QueryBuilder) Distinct() *QueryBuilder {
+	q.distinct = true
+	return q
+}
+
+// DistinctOn emits DISTINCT ON (fields...), fields must match the leftmost
+// OrderBy fields (in any order), as required by Postgres/CockroachDB.
+func (q *QueryBuilder) DistinctOn(fields ...string) *QueryBuilder {
+	q.distinctOn = fields
+	return q
+}
+
 func (q *QueryBuilder) WithErr(errp *error) *QueryBuilder {
 	q.errp = errp
 	return q
 }
 
-func (q *QueryBuilder) quotedTableName(si *StructInfo) string {
-	tname := q.quotedTable
-	if tname == "" {
-		tname = si.QuotedName
+// table name without alias
+func (q *QueryBuilder) qualifiedTableName(si *StructInfo) string {
+	t := q.table
+	if !q.hasTable() {
+		if si == nil {
+			panic("table must be specified explicitly, there is no struct to derive it from")
+		}
+		t = si.tableName()
+	}
+	if q.schema != "" {
+		t.schema = q.schema
 	}
+	return q.b.quoteTableName(t)
+}
+
+func (q *QueryBuilder) quotedTableName(si *StructInfo) string {
+	tname := q.qualifiedTableName(si)
 
 	if q.prefix != "" {
 		return tname + " AS " + q.prefix
@@ -114,85 +411,217 @@ func (q *QueryBuilder) quotedTableName(si *StructInfo) string {
 	return tname
 }
 
-func (q *QueryBuilder) prefixedFieldName(name string) string {
-	if q.prefix != "" {
-		return q.prefix + "." + name
+func prefixedName(prefix, name string) string {
+	if prefix != "" {
+		return prefix + "." + name
 	} else {
 		return name
 	}
 }
 
+func findFieldOrPanic(si *StructInfo, name string) *FieldInfo {
+	f := si.FindField(name)
+	if f == nil {
+		panic("unknown column: " + name + " (in table: " + si.QuotedName + ")")
+	}
+	return f
+}
+
+// returns struct fields which are going to be selected, respects Columns(),
+// Group() and Omit()
+func (q *QueryBuilder) structFields(si *StructInfo) []*FieldInfo {
+	var out []*FieldInfo
+	if q.columnNames != nil {
+		for _, name := range q.columnNames {
+			out = append(out, findFieldOrPanic(si, name))
+		}
+	} else if q.group != "" {
+		assertHasGroup(si, q.group)
+		out = filterFields(si, func(f *FieldInfo) bool {
+			return f.Group == q.group || f.IsPrimaryKey()
+		})
+	} else {
+		for i := range si.Fields {
+			out = append(out, &si.Fields[i])
+		}
+	}
+	if q.omitNames == nil {
+		return out
+	}
+
+	omitted := map[*FieldInfo]struct{}{}
+	for _, name := range q.omitNames {
+		omitted[findFieldOrPanic(si, name)] = struct{}{}
+	}
+	n := 0
+	for _, f := range out {
+		if _, ok := omitted[f]; !ok {
+			out[n] = f
+			n++
+		}
+	}
+	if n == 0 {
+		panic("all columns were omitted (in table: " + si.QuotedName + ")")
+	}
+	return out[:n]
+}
+
 func (q *QueryBuilder) columns(sb *strings.Builder, si *StructInfo) {
+	q.columnsWithPrefix(sb, si, q.prefix)
+}
+
+func (q *QueryBuilder) columnsWithPrefix(sb *strings.Builder, si *StructInfo, prefix string) {
 	fieldNamesWriter := helper.NewListWriter(sb)
 	if q.fields != nil {
 		for _, f := range q.fields {
-			fieldNamesWriter.WriteString(q.prefixedFieldName(f))
+			fieldNamesWriter.WriteString(prefixedName(prefix, f))
 		}
+	} else if si == nil {
+		// dynamic target, select everything
+		fieldNamesWriter.WriteString(prefixedName(prefix, "*"))
 	} else {
-		for _, f := range si.Fields {
-			fieldNamesWriter.WriteString(q.prefixedFieldName(f.QuotedName))
+		for _, f := range q.structFields(si) {
+			fieldNamesWriter.WriteString(prefixedName(prefix, f.QuotedName))
 		}
 	}
 }
 
-var specialRegexp = regexp.MustCompile(`:[a-z]+:`)
+func quotedColumnName(name string, si *StructInfo) string {
+	if si != nil {
+		return findFieldOrPanic(si, name).QuotedName
+	}
+	return pq.QuoteIdentifier(name)
+}
 
-func (q *QueryBuilder) writeRawTo(sb *strings.Builder, si *StructInfo) {
-	var tmp strings.Builder
-	q.raw.WriteTo(&tmp)
-	sb.WriteString(specialRegexp.ReplaceAllStringFunc(tmp.String(), func(v string) string {
-		if len(v) < 2 {
-			return v
-		}
-		v = v[1 : len(v)-1]
-		if v == "columns" {
-			var sb strings.Builder
-			q.columns(&sb, si)
-			return sb.String()
-		} else if v == "table" {
-			return q.quotedTableName(si)
-		} else {
-			return v
+func (q *QueryBuilder) writeDistinct(sb *strings.Builder, si *StructInfo) {
+	if len(q.distinctOn) == 0 {
+		if q.distinct {
+			sb.WriteString("DISTINCT ")
+		}
+		return
+	}
+
+	on := map[string]struct{}{}
+	sb.WriteString("DISTINCT ON (")
+	onWriter := helper.NewListWriter(sb)
+	for _, f := range q.distinctOn {
+		name := quotedColumnName(f, si)
+		on[name] = struct{}{}
+		onWriter.WriteString(name)
+	}
+	sb.WriteString(") ")
+
+	for i := 0; i < len(q.orderByFields) && i < len(q.distinctOn); i++ {
+		name := q.orderByFields[i].quotedName(si, q.prefix)
+		if _, ok := on[name]; !ok {
+			panic("DISTINCT ON fields must match the leftmost ORDER BY fields, got: " + name)
 		}
-	}))
+	}
 }
 
-func (q *QueryBuilder) WriteTo(sb *strings.Builder, si *StructInfo) {
-	// WHERE
-	if len(q.whereExprs) != 0 {
-		sb.WriteString(" WHERE ")
+// Built-in Raw placeholders:
+//
+//	:columns:        - list of selected columns (respects Prefix)
+//	:columns(alias): - same, but each column is prefixed with the given alias
+//	:table:          - table name (respects Prefix)
+//	:pk:             - list of primary key columns (respects Prefix)
+//	:where:          - Where conditions joined with AND, TRUE if there are none
+//	:order:          - ORDER BY clause, empty if there is none
+//	:limit:          - LIMIT/OFFSET clause, empty if there is none
+//
+// Custom placeholders are defined via With(). Unknown placeholders cause a panic.
+func (q *QueryBuilder) rawPlaceholder(name, arg string, si *StructInfo) string {
+	var sb strings.Builder
+	if name == "columns" && arg != "" {
+		q.columnsWithPrefix(&sb, si, arg)
+		return sb.String()
+	} else if arg != "" {
+		panic("placeholder doesn't take arguments: :" + name + "(" + arg + "):")
 	}
+
+	switch name {
+	case "columns":
+		q.columns(&sb, si)
+	case "table":
+		sb.WriteString(q.quotedTableName(si))
+	case "pk":
+		if si == nil {
+			panic(":pk: placeholder requires a struct target")
+		}
+		assertHasPrimaryKeys(si)
+		pkWriter := helper.NewListWriter(&sb)
+		for _, f := range si.PrimaryKeys {
+			pkWriter.WriteString(prefixedName(q.prefix, f.QuotedName))
+		}
+	case "where":
+		if !q.hasWhere(si) {
+			sb.WriteString("TRUE")
+		}
+		q.writeWhere(&sb, si)
+	case "order":
+		q.writeOrderBy(&sb, si)
+	case "limit":
+		q.writeLimit(&sb)
+	default:
+		v, ok := q.rawVars[name]
+		if !ok {
+			panic("unknown placeholder: :" + name + ":")
+		}
+		v.WriteTo(&sb)
+	}
+	return strings.TrimPrefix(sb.String(), " ")
+}
+
+func (q *QueryBuilder) writeRawTo(sb *strings.Builder, si *StructInfo) {
+	var tmp, resolved strings.Builder
+	q.raw.WriteTo(&tmp)
+	resolveColumnRefs(tmp.String(), &resolved, si, q.prefix)
+	replaceRawPlaceholders(resolved.String(), sb, func(name, arg string) string {
+		return q.rawPlaceholder(name, arg, si)
+	})
+}
+
+func (q *QueryBuilder) writeWhere(sb *strings.Builder, si *StructInfo) {
+	var tmp strings.Builder
 	for i, w := range q.whereExprs {
-		w.WriteTo(sb)
+		w.WriteTo(&tmp)
 		if i != len(q.whereExprs)-1 {
+			tmp.WriteString(" AND ")
+		}
+	}
+	resolveColumnRefs(tmp.String(), sb, si, q.prefix)
+	if cond := q.softDeleteCond(si); cond != "" {
+		if len(q.whereExprs) != 0 {
 			sb.WriteString(" AND ")
 		}
+		sb.WriteString(cond)
 	}
+}
 
-	// ORDER BY
+func (q *QueryBuilder) writeOrderBy(sb *strings.Builder, si *StructInfo) {
 	if len(q.orderByFields) != 0 {
 		sb.WriteString(" ORDER BY ")
 	}
 	for i, f := range q.orderByFields {
-		if si != nil {
-			ff := si.FindField(f.field)
-			if ff == nil {
-				panic("unknown column: " + f.field + " (in table: " + si.QuotedName + ")")
-			}
-			sb.WriteString(ff.QuotedName)
-		} else {
-			sb.WriteString(pq.QuoteIdentifier(f.field))
-		}
+		sb.WriteString(f.quotedName(si, q.prefix))
 		if f.asc {
 			sb.WriteString(" ASC")
 		} else {
 			sb.WriteString(" DESC")
 		}
+		switch f.nulls {
+		case NullsFirst:
+			sb.WriteString(" NULLS FIRST")
+		case NullsLast:
+			sb.WriteString(" NULLS LAST")
+		}
 		if i != len(q.orderByFields)-1 {
 			sb.WriteString(", ")
 		}
 	}
+}
 
+func (q *QueryBuilder) writeLimit(sb *strings.Builder) {
 	// LIMIT
 	if q.limitDefined {
 		q.b.Expr(" LIMIT ?", q.limit).WriteTo(sb)
@@ -204,6 +633,33 @@ func (q *QueryBuilder) WriteTo(sb *strings.Builder, si *StructInfo) {
 	}
 }
 
+func (q *QueryBuilder) WriteTo(sb *strings.Builder, si *StructInfo) {
+	// WHERE
+	if q.hasWhere(si) {
+		sb.WriteString(" WHERE ")
+	}
+	q.writeWhere(sb, si)
+
+	// ORDER BY
+	q.writeOrderBy(sb, si)
+
+	// LIMIT, OFFSET
+	q.writeLimit(sb)
+}
+
+func (q *QueryBuilder) writeSelectTo(sb *strings.Builder, si *StructInfo) {
+	if q.rawDefined {
+		q.writeRawTo(sb, si)
+		return
+	}
+	sb.WriteString("SELECT ")
+	q.writeDistinct(sb, si)
+	q.columns(sb, si)
+	sb.WriteString(" FROM ")
+	sb.WriteString(q.quotedTableName(si))
+	q.WriteTo(sb, si)
+}
+
 func (q *QueryBuilder) End() *Batch {
 	return q.b.Select(q)
 }
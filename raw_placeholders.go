@@ -0,0 +1,84 @@
+package sqlbatch
+
+import (
+	"strings"
+)
+
+func isRawPlaceholderNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c == '_'
+}
+
+func isRawPlaceholderArgChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func isRawPlaceholderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isRawPlaceholderNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// tries to parse :name: or :name(arg): placeholder at s[i], returns the end
+// index or -1 if there is no placeholder, casts like "::jsonb" are not
+// placeholders
+func parseRawPlaceholder(s string, i int) (name, arg string, end int) {
+	if i > 0 && s[i-1] == ':' {
+		return "", "", -1
+	}
+	j := i + 1
+	for j < len(s) && isRawPlaceholderNameChar(s[j]) {
+		j++
+	}
+	if j == i+1 {
+		return "", "", -1
+	}
+	name = s[i+1 : j]
+	if j < len(s) && s[j] == '(' {
+		k := j + 1
+		for k < len(s) && isRawPlaceholderArgChar(s[k]) {
+			k++
+		}
+		if k == len(s) || s[k] != ')' {
+			return "", "", -1
+		}
+		arg = s[j+1 : k]
+		j = k + 1
+	}
+	if j >= len(s) || s[j] != ':' || j+1 < len(s) && s[j+1] == ':' {
+		return "", "", -1
+	}
+	return name, arg, j + 1
+}
+
+// Replaces all :name: placeholders in s using f and writes the result to sb.
+// Quoted strings, identifiers and comments are left intact.
+func replaceRawPlaceholders(s string, sb *strings.Builder, f func(name, arg string) string) {
+	last := 0
+	for i := 0; i < len(s); {
+		if j := skipNonCode(s, i); j != i {
+			i = j
+			continue
+		}
+		switch s[i] {
+		case ':':
+			name, arg, end := parseRawPlaceholder(s, i)
+			if end == -1 {
+				i++
+				continue
+			}
+			sb.WriteString(s[last:i])
+			sb.WriteString(f(name, arg))
+			i = end
+			last = end
+		default:
+			i++
+		}
+	}
+	sb.WriteString(s[last:])
+}
@@ -1,6 +1,7 @@
 package sqlbatch
 
 import (
+	"database/sql"
 	"reflect"
 	"unsafe"
 )
@@ -9,8 +10,234 @@ type readInto struct {
 	val       reflect.Value  // pointer with type info
 	ptr       unsafe.Pointer // raw pointer
 	si        *StructInfo
+	fields    []*FieldInfo // subset of si.Fields which is selected
 	slice     bool
 	errp      *error
-	primitive bool // is primitive type? (fallback to reflect API)
+	primitive bool       // is primitive type? (fallback to reflect API)
+	extra     []any      // additional primitive targets for multi-column single row reads
+	dynamic   bool       // is map[string]any? (columns are discovered at runtime)
+	keyField  *FieldInfo // if not nil, target is map[K]T or map[K][]T keyed by that field
+	mapSlices bool       // is map[K][]T?
+	preloads  []*RelationInfo
 	stmt      string
 }
+
+// scans rows into *map[K]T or *map[K][]T
+func (r *readInto) scanKeyed(rows *sql.Rows) error {
+	// always a fresh map, like slice targets, results of a previous Run must
+	// not be mixed with the new ones
+	mval := r.val.Elem()
+	mval.Set(reflect.MakeMap(mval.Type()))
+	keyType := mval.Type().Key()
+	structType := mval.Type().Elem()
+	if r.mapSlices {
+		structType = structType.Elem()
+	}
+
+	ptrs := make([]any, len(r.fields))
+	var keyPtr any
+	for rows.Next() {
+		elem := reflect.New(structType)
+		ptr := unsafe.Pointer(elem.Pointer())
+		for i, f := range r.fields {
+			f.Interface.GetPtr(ptr, &ptrs[i])
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		r.keyField.Interface.GetPtr(ptr, &keyPtr)
+		key := reflect.ValueOf(keyPtr).Elem().Convert(keyType)
+		if r.mapSlices {
+			s := mval.MapIndex(key)
+			if !s.IsValid() {
+				s = reflect.Zero(mval.Type().Elem())
+			}
+			mval.SetMapIndex(key, reflect.Append(s, elem.Elem()))
+		} else {
+			mval.SetMapIndex(key, elem.Elem())
+		}
+	}
+	return rows.Err()
+}
+
+// scans rows into the target, returns the number of scanned rows
+func (r *readInto) scan(rows *sql.Rows) (int, error) {
+	if r.dynamic {
+		return 0, r.scanDynamic(rows)
+	} else if r.keyField != nil {
+		return 0, r.scanKeyed(rows)
+	}
+
+	var numArgs int
+	if r.primitive {
+		numArgs = 1 + len(r.extra)
+	} else {
+		numArgs = len(r.fields)
+	}
+	ptrs := make([]any, numArgs)
+	if r.slice {
+		val := r.val.Elem() // get the slice itself
+		idx := 0
+		for {
+			gotNext := rows.Next()
+			if !gotNext {
+				break
+			}
+			if idx >= val.Cap() {
+				newCap := val.Cap() * 2
+				if idx >= newCap {
+					newCap = idx + 1
+				}
+				newSlice := reflect.MakeSlice(val.Type(), val.Len(), newCap)
+				reflect.Copy(newSlice, val)
+				val.Set(newSlice)
+			}
+			if idx >= val.Len() {
+				val.SetLen(idx + 1)
+			}
+			if r.primitive {
+				ptrs[0] = val.Index(idx).Addr().Interface()
+			} else {
+				if len(r.fields) != len(r.si.Fields) {
+					// partial select, make sure unselected fields don't keep stale values
+					val.Index(idx).Set(reflect.Zero(val.Type().Elem()))
+				}
+				ptr := unsafe.Pointer(val.Index(idx).Addr().Pointer())
+				for i, f := range r.fields {
+					f.Interface.GetPtr(ptr, &ptrs[i])
+				}
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return idx, err
+			}
+			idx++
+		}
+		val.SetLen(idx)
+		return idx, nil
+	}
+
+	hasValue := rows.Next()
+	if !hasValue {
+		if r.errp != nil {
+			*r.errp = ErrNotFound
+		}
+		return 0, nil
+	}
+	if r.primitive {
+		ptrs[0] = r.val.Interface()
+		copy(ptrs[1:], r.extra)
+	} else {
+		if len(r.fields) != len(r.si.Fields) {
+			// partial select, make sure unselected fields don't keep stale values
+			r.val.Elem().Set(reflect.Zero(r.val.Type().Elem()))
+		}
+		for i, f := range r.fields {
+			f.Interface.GetPtr(r.ptr, &ptrs[i])
+		}
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		// skip all the extra rows for single item fetch
+	}
+	return 1, nil
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// Converts value returned by the driver according to the column type. Byte
+// slices are only kept as is for binary columns, everything else which comes
+// as bytes (numeric, uuid, jsonb, etc.) is converted to string.
+func convertDynamicValue(v any, ct *sql.ColumnType) any {
+	if v == nil {
+		return nil
+	}
+	st := ct.ScanType()
+	if bytes, ok := v.([]byte); ok {
+		if st != nil && st == reflect.TypeOf(bytes) {
+			return bytes
+		}
+		return string(bytes)
+	}
+	if st == nil {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type() != st && isNumericKind(rv.Kind()) && isNumericKind(st.Kind()) {
+		return rv.Convert(st).Interface()
+	}
+	return v
+}
+
+func scanDynamicRow(rows *sql.Rows, types []*sql.ColumnType, vals []any, ptrs []any) (map[string]any, error) {
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(types))
+	for i, ct := range types {
+		out[ct.Name()] = convertDynamicValue(vals[i], ct)
+	}
+	return out, nil
+}
+
+// scans rows into *map[string]any or *[]map[string]any
+func (r *readInto) scanDynamic(rows *sql.Rows) error {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	vals := make([]any, len(types))
+	ptrs := make([]any, len(types))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+
+	if r.slice {
+		sp := r.val.Interface().(*[]map[string]any)
+		*sp = (*sp)[:0]
+		for rows.Next() {
+			m, err := scanDynamicRow(rows, types, vals, ptrs)
+			if err != nil {
+				return err
+			}
+			*sp = append(*sp, m)
+		}
+		return rows.Err()
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if r.errp != nil {
+			*r.errp = ErrNotFound
+		}
+		return nil
+	}
+	m, err := scanDynamicRow(rows, types, vals, ptrs)
+	if err != nil {
+		return err
+	}
+	mp := r.val.Interface().(*map[string]any)
+	if *mp == nil {
+		*mp = m
+	} else {
+		for k, v := range m {
+			(*mp)[k] = v
+		}
+	}
+	for rows.Next() {
+		// skip all the extra rows for single item fetch
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package sqlbatch
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/nsf/sqlbatch/util"
+	"reflect"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// returns true if t or a pointer to t implements driver.Valuer
+func isValuerType(t reflect.Type) bool {
+	return t.Implements(valuerType) || reflect.PointerTo(t).Implements(valuerType)
+}
+
+func appendDriverValue(b *strings.Builder, v driver.Value) {
+	switch val := v.(type) {
+	case nil:
+		b.WriteString("NULL")
+	case int64:
+		util.AppendInt64(b, val, false)
+	case float64:
+		util.AppendFloat64(b, val, false)
+	case bool:
+		util.AppendBool(b, val, false)
+	case []byte:
+		util.AppendByteSlice(b, val, val == nil)
+	case string:
+		util.AppendString(b, val, false)
+	case time.Time:
+		util.AppendTime(b, val, false)
+	default:
+		panic(fmt.Sprintf("unsupported driver.Value type: %T", v))
+	}
+}
+
+// p points to a value of type t
+func appendValuer(b *strings.Builder, t reflect.Type, p unsafe.Pointer) {
+	ptr := reflect.NewAt(t, p)
+	var valuer driver.Valuer
+	if t.Implements(valuerType) {
+		if t.Kind() == reflect.Pointer && ptr.Elem().IsNil() {
+			b.WriteString("NULL")
+			return
+		}
+		valuer = ptr.Elem().Interface().(driver.Valuer)
+	} else {
+		valuer = ptr.Interface().(driver.Valuer)
+	}
+	v, err := valuer.Value()
+	if err != nil {
+		panic(err)
+	}
+	appendDriverValue(b, v)
+}
+
+func makeValuerPtrGetter(t reflect.Type, offset uintptr) func(structPtr unsafe.Pointer, ifacePtr *any) {
+	return func(structPtr unsafe.Pointer, ifacePtr *any) {
+		p := unsafe.Pointer(uintptr(structPtr) + offset)
+		*ifacePtr = reflect.NewAt(t, p).Interface()
+	}
+}
+
+func makeValuerWriter(t reflect.Type, offset uintptr) func(structPtr unsafe.Pointer, b *strings.Builder) {
+	return func(structPtr unsafe.Pointer, b *strings.Builder) {
+		p := unsafe.Pointer(uintptr(structPtr) + offset)
+		appendValuer(b, t, p)
+	}
+}
+
+func makeValuerConverter(t reflect.Type) func(iface any, b *strings.Builder) {
+	return func(iface any, b *strings.Builder) {
+		v := reflect.New(t)
+		v.Elem().Set(reflect.ValueOf(iface))
+		appendValuer(b, t, v.UnsafePointer())
+	}
+}
+
+func makeValuerInterface(t reflect.Type, offset uintptr) FieldInterface {
+	return FieldInterface{
+		GetPtr: makeValuerPtrGetter(t, offset),
+		Write:  makeValuerWriter(t, offset),
+		Conv:   makeValuerConverter(t),
+	}
+}
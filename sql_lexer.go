@@ -0,0 +1,190 @@
+package sqlbatch
+
+import (
+	"strings"
+)
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+// skips quoted string or identifier starting at s[i], returns index right after it
+func skipQuoted(s string, i int) int {
+	quote := s[i]
+	i++
+	for i < len(s) {
+		if s[i] == quote {
+			if i+1 < len(s) && s[i+1] == quote {
+				// escaped quote
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// skips E'...' string starting at s[i] (the quote), backslash escapes are allowed
+func skipEscapeString(s string, i int) int {
+	i++
+	for i < len(s) {
+		switch s[i] {
+		case '\\':
+			i += 2
+			continue
+		case '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(s)
+}
+
+// parses $tag$ at s[i], returns the tag including dollar signs or "" if there is none
+func parseDollarTag(s string, i int) string {
+	if i > 0 && isIdentChar(s[i-1]) {
+		// part of an identifier
+		return ""
+	}
+	j := i + 1
+	if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+		// $1 style parameter
+		return ""
+	}
+	for j < len(s) && s[j] != '$' && isIdentChar(s[j]) {
+		j++
+	}
+	if j == len(s) || s[j] != '$' {
+		return ""
+	}
+	return s[i : j+1]
+}
+
+// skips /* */ comment starting at s[i], nested comments are allowed
+func skipBlockComment(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		if strings.HasPrefix(s[i:], "/*") {
+			depth++
+			i += 2
+		} else if strings.HasPrefix(s[i:], "*/") {
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		} else {
+			i++
+		}
+	}
+	return i
+}
+
+// Returns the index right after the string literal, quoted identifier,
+// dollar-quoted string or comment starting at s[i], or i if there is none.
+// Placeholders are never looked for inside of those.
+func skipNonCode(s string, i int) int {
+	switch c := s[i]; {
+	case c == '\'' || c == '"':
+		return skipQuoted(s, i)
+	case (c == 'E' || c == 'e') && i+1 < len(s) && s[i+1] == '\'' && (i == 0 || !isIdentChar(s[i-1])):
+		return skipEscapeString(s, i+1)
+	case c == '$':
+		tag := parseDollarTag(s, i)
+		if tag == "" {
+			return i
+		}
+		end := strings.Index(s[i+len(tag):], tag)
+		if end == -1 {
+			return len(s)
+		}
+		return i + len(tag) + end + len(tag)
+	case c == '-' && strings.HasPrefix(s[i:], "--"):
+		end := strings.IndexByte(s[i:], '\n')
+		if end == -1 {
+			return len(s)
+		}
+		return i + end + 1
+	case c == '/' && strings.HasPrefix(s[i:], "/*"):
+		return skipBlockComment(s, i)
+	}
+	return i
+}
+
+// Replaces ? placeholders in s with formatted args. "??" is an escape for a
+// literal question mark, "?|" and "?&" are JSONB operators and not
+// placeholders. Templates without args go through unescapePositional instead.
+// Handles templates without args: a lone "?" is an operator there (e.g.
+// Expr("data ? 'k'")), but "??" is still an escape, so that it means the same
+// regardless of the number of args.
+func unescapePositional(s string) string {
+	var sb strings.Builder
+	last := 0
+	for i := 0; i < len(s); {
+		if j := skipNonCode(s, i); j != i {
+			i = j
+			continue
+		}
+		if s[i] == '?' && i+1 < len(s) && s[i+1] == '?' {
+			sb.WriteString(s[last : i+1])
+			i += 2
+			last = i
+			continue
+		}
+		i++
+	}
+	if last == 0 {
+		return s
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+func formatPositional(b *Batch, s string, args []any) string {
+	var sb strings.Builder
+	n := 0
+	last := 0
+	for i := 0; i < len(s); {
+		if j := skipNonCode(s, i); j != i {
+			i = j
+			continue
+		}
+		if s[i] != '?' {
+			i++
+			continue
+		}
+		if i+1 < len(s) {
+			switch next := s[i+1]; next {
+			case '?':
+				sb.WriteString(s[last : i+1])
+				i += 2
+				last = i
+				continue
+			case '|', '&':
+				if i+2 >= len(s) || s[i+2] != next {
+					// ?| or ?& operator
+					i += 2
+					continue
+				}
+			}
+		}
+		sb.WriteString(s[last:i])
+		if n < len(args) {
+			b.writeArg(args[n], &sb)
+		}
+		n++
+		i++
+		last = i
+	}
+	if n != len(args) {
+		panic("invalid number of arguments, number of arguments should match number of ? placeholders")
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
@@ -2,7 +2,6 @@ package sqlbatch
 
 import (
 	"database/sql"
-	"github.com/codemodus/kace"
 	"github.com/lib/pq"
 	"reflect"
 	"sync"
@@ -10,10 +9,16 @@ import (
 )
 
 type StructInfo struct {
-	// name of the struct is converted to snake case
+	// name of the struct is converted to snake case (see NamingStrategy), can
+	// be overridden by implementing TableNamer or with a tag on a blank field:
+	//   _ struct{} `db:"table:accounts"`
+	// Qualified names like "app.accounts" set Schema too.
 	Name       string
 	QuotedName string
 
+	// optional, set with a tag on a blank field: _ struct{} `db:"schema:app"`
+	Schema string
+
 	// Fields are flattened, which means embedded struct fields are there too.
 	// All field names are converted to snake case and must be unique,
 	// if field is repeated it's skipped.
@@ -24,13 +29,78 @@ type StructInfo struct {
 	//   `db:"primary_key"`            - assume column is a primary key
 	//   `db:"column:foo,primary_key"` - both (comma separated)
 	//   `db:"-"`                      - skip the field
-	//   `db:"group:bar"`              - for embedded structs, assign it to a group
+	//   `db:"group:bar"`              - for embedded structs, assign it to a group, see UpdateGroup()
 	//   `db:"created"`                - must be time.Time or pq.NullTime, value assigned on Insert()
 	//   `db:"updated"`                - must be time.Time or pq.NullTime, value assigned on Update()
+	//   `db:"deleted"`                - must be pq.NullTime, enables soft deletes, see Delete()
+	//   `db:"version"`                - integer, enables optimistic locking on Update(), see ErrStaleVersion
 	//   `db:"default"`                - override field value to DEFAULT on INSERT
+	//   `db:"readonly"`               - selected, but never written (e.g. computed columns)
+	//   `db:"insertonly"`             - never updated, Upsert() uses INSERT ... ON CONFLICT DO UPDATE
+	//   `db:"noinsert"`               - not written by Insert() and Upsert(), only by Update()
+	//   `db:"has_many:fk=foo_id"`     - []T field, rows of T with foo_id = primary key, see Preload()
+	//   `db:"belongs_to:fk=bar_id"`   - T or *T field, row of T with primary key = bar_id, see Preload()
 	Fields         []FieldInfo
 	PrimaryKeys    []*FieldInfo
 	NonPrimaryKeys []*FieldInfo
+
+	// Relations are not columns, they are filled by QueryBuilder.Preload().
+	Relations []RelationInfo
+
+	// field with "deleted" tag, nil if the struct doesn't use soft deletes
+	SoftDelete *FieldInfo
+
+	// field with "version" tag, nil if the struct doesn't use optimistic locking
+	Version *FieldInfo
+}
+
+// TableNamer can be implemented by a struct (with value or pointer receiver) to
+// override its table name.
+type TableNamer interface {
+	TableName() string
+}
+
+var tableNamerType = reflect.TypeOf((*TableNamer)(nil)).Elem()
+
+func structTableName(t reflect.Type, naming NamingStrategy) string {
+	if reflect.PointerTo(t).Implements(tableNamerType) {
+		return reflect.New(t).Interface().(TableNamer).TableName()
+	}
+	return naming.TableName(t.Name())
+}
+
+type RelationKind int
+
+const (
+	RelationHasMany RelationKind = iota + 1
+	RelationBelongsTo
+)
+
+type RelationInfo struct {
+	Kind       RelationKind
+	Name       string // name of the struct field
+	ForeignKey string // column name of the foreign key
+	Type       reflect.Type
+	Offset     uintptr
+}
+
+// type of the related struct
+func (r *RelationInfo) StructType() reflect.Type {
+	t := r.Type
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func (si *StructInfo) FindRelation(name string) *RelationInfo {
+	for i := range si.Relations {
+		r := &si.Relations[i]
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
 }
 
 func (si *StructInfo) FindField(name string) *FieldInfo {
@@ -56,7 +126,12 @@ func filterPrimaryKeys(fields []FieldInfo, v bool) []*FieldInfo {
 var typeInfoCache = map[reflect.Type]*FieldInterface{}
 var typeInfoCacheLock sync.RWMutex
 
-var structInfoCache = map[reflect.Type]*StructInfo{}
+type structInfoCacheKey struct {
+	t      reflect.Type
+	naming NamingStrategy
+}
+
+var structInfoCache = map[structInfoCacheKey]*StructInfo{}
 var structInfoCacheLock sync.RWMutex
 
 type FieldInterfaceResolver func(t reflect.Type, offset uintptr) (FieldInterface, bool)
@@ -73,6 +148,11 @@ func makeInterfaceForType(t reflect.Type, o uintptr, custom FieldInterfaceResolv
 	if iface, ok := resolveCustomFieldInterface(t, o, custom); ok {
 		return iface
 	}
+	if t.PkgPath() != "" && isValuerType(t) && !isTypeNull(t) {
+		// named types implementing driver.Valuer take precedence over their
+		// kind, e.g. type Status int with Value() returning a string
+		return makeValuerInterface(t, o)
+	}
 	switch t.Kind() {
 	case reflect.Bool:
 		return FieldInterface{
@@ -250,6 +330,11 @@ func makeInterfaceForType(t reflect.Type, o uintptr, custom FieldInterfaceResolv
 		}
 	}
 
+	if isValuerType(t) && !isTypeNull(t) {
+		// any other type implementing driver.Valuer, e.g. *Decimal
+		return makeValuerInterface(t, o)
+	}
+
 	panic("unsupported field type: " + t.String())
 }
 
@@ -277,21 +362,33 @@ func GetTypeInfo(t reflect.Type, custom FieldInterfaceResolver) *FieldInterface
 }
 
 func GetStructInfo(t reflect.Type, custom FieldInterfaceResolver) *StructInfo {
-	// quick path, let's try reading saved value
+	return GetStructInfoWithNaming(t, custom, defaultNaming)
+}
+
+func cachedStructInfo(key structInfoCacheKey) (*StructInfo, bool) {
 	structInfoCacheLock.RLock()
-	v, ok := structInfoCache[t]
-	if ok {
-		structInfoCacheLock.RUnlock()
+	defer structInfoCacheLock.RUnlock()
+	v, ok := structInfoCache[key]
+	return v, ok
+}
+
+// GetStructInfoWithNaming is the same as GetStructInfo, but table and column
+// names are derived using the given naming strategy.
+func GetStructInfoWithNaming(t reflect.Type, custom FieldInterfaceResolver, naming NamingStrategy) *StructInfo {
+	assertComparableNaming(naming)
+	key := structInfoCacheKey{t: t, naming: naming}
+
+	// quick path, let's try reading saved value
+	if v, ok := cachedStructInfo(key); ok {
 		return v
 	}
-	structInfoCacheLock.RUnlock()
 
 	// slow path here, let's scan the struct
 	structInfoCacheLock.Lock()
 	defer structInfoCacheLock.Unlock()
 
-	info := ScanStruct(t, 0, custom)
-	structInfoCache[t] = info
+	info := scanStructImpl(t, &scanStructCtx{custom: custom, naming: naming})
+	structInfoCache[key] = info
 	return info
 }
 
@@ -318,6 +415,7 @@ func isTypeNull(t reflect.Type) bool {
 
 type scanStructCtx struct {
 	custom FieldInterfaceResolver
+	naming NamingStrategy
 	offset uintptr
 	group  string
 }
@@ -327,9 +425,11 @@ func scanStructImpl(t reflect.Type, ctx *scanStructCtx) *StructInfo {
 		panic("struct type expected")
 	}
 
-	structName := kace.Snake(t.Name())
+	structName := structTableName(t, ctx.naming)
+	schema := ""
 	fields := []FieldInfo{}
 	fieldsMap := map[string]struct{}{}
+	var relations []RelationInfo
 
 	addFieldMaybe := func(f FieldInfo) {
 		if _, ok := fieldsMap[f.Name]; !ok {
@@ -340,6 +440,17 @@ func scanStructImpl(t reflect.Type, ctx *scanStructCtx) *StructInfo {
 
 	for i, n := 0, t.NumField(); i < n; i++ {
 		f := t.Field(i)
+		if f.Name == "_" {
+			// struct-level tags
+			if tagVal, ok := f.Tag.Lookup("db"); ok {
+				ti := parseTag(tagVal)
+				if ti.table != "" {
+					structName = ti.table
+				}
+				schema = ti.schema
+			}
+			continue
+		}
 		if f.PkgPath != "" {
 			// unexported field
 			continue
@@ -363,20 +474,34 @@ func scanStructImpl(t reflect.Type, ctx *scanStructCtx) *StructInfo {
 			// embedded field
 			emCtx := &scanStructCtx{
 				custom: ctx.custom,
+				naming: ctx.naming,
 				offset: ctx.offset + f.Offset,
 				group:  ti.group,
 			}
-			for _, ef := range scanStructImpl(f.Type, emCtx).Fields {
+			esi := scanStructImpl(f.Type, emCtx)
+			for _, ef := range esi.Fields {
 				addFieldMaybe(ef)
 			}
+			relations = append(relations, esi.Relations...)
 		} else {
 			if ti.ignore {
 				continue
 			}
 
-			if ti.isCreated || ti.isUpdated {
+			if ti.relation != "" {
+				relations = append(relations, makeRelationInfo(f, ti, ctx.offset))
+				continue
+			}
+
+			if ti.isCreated || ti.isUpdated || ti.isDeleted {
 				assertTypeIsTime(f.Type)
 			}
+			if ti.isDeleted && f.Type != reflect.TypeOf(pq.NullTime{}) {
+				panic("deleted field must be pq.NullTime")
+			}
+			if ti.isVersion && !isVersionKind(f.Type.Kind()) {
+				panic("version field must be a signed integer")
+			}
 
 			flags := FieldInfoFlag(0)
 			if ti.primaryKey {
@@ -388,40 +513,117 @@ func scanStructImpl(t reflect.Type, ctx *scanStructCtx) *StructInfo {
 			if ti.isUpdated {
 				flags |= FieldInfoIsUpdated
 			}
+			if ti.isDeleted {
+				flags |= FieldInfoIsDeleted
+			}
+			if ti.isVersion {
+				flags |= FieldInfoIsVersion
+			}
 			if ti.isDefault {
 				flags |= FieldInfoIsDefault
 			}
+			if ti.readOnly {
+				flags |= FieldInfoIsReadOnly
+			}
+			if ti.insertOnly {
+				flags |= FieldInfoIsInsertOnly
+			}
+			if ti.noInsert {
+				flags |= FieldInfoIsNoInsert
+			}
 			if isTypeNull(f.Type) {
 				flags |= FieldInfoIsNull
 			}
 
 			field := FieldInfo{
 				flags:     flags,
-				Name:      kace.Snake(f.Name),
+				Name:      ctx.naming.ColumnName(f.Name),
+				GoName:    f.Name,
+				Offset:    ctx.offset + f.Offset,
 				Interface: MakeFieldInterfaceForField(f, ctx.offset, ctx.custom),
 				Group:     ctx.group,
 				Type:      f.Type,
 			}
 			if ti.name != "" {
 				field.Name = ti.name
+			} else if ctx.group != "" {
+				field.Name = ctx.naming.GroupColumnName(ctx.group, field.Name)
 			}
 			field.QuotedName = pq.QuoteIdentifier(field.Name)
 			addFieldMaybe(field)
 		}
 	}
 
+	var softDelete, version *FieldInfo
+	for i := range fields {
+		if fields[i].IsDeleted() {
+			if softDelete != nil {
+				panic("only one deleted field is allowed")
+			}
+			softDelete = &fields[i]
+		}
+		if fields[i].IsVersion() {
+			if version != nil {
+				panic("only one version field is allowed")
+			}
+			version = &fields[i]
+		}
+	}
+
+	// "schema.table" names are split, so that the schema is quoted separately
+	tn := parseTableName(structName)
+	if tn.db != "" {
+		panic("struct table name can't include a database: " + structName)
+	}
+	if tn.schema != "" {
+		if schema != "" && schema != tn.schema {
+			panic("struct table name schema conflicts with the schema tag: " + structName)
+		}
+		schema = tn.schema
+		structName = tn.name
+	}
+
 	return &StructInfo{
 		Name:           structName,
 		QuotedName:     pq.QuoteIdentifier(structName),
+		Schema:         schema,
 		Fields:         fields,
 		PrimaryKeys:    filterPrimaryKeys(fields, true),
 		NonPrimaryKeys: filterPrimaryKeys(fields, false),
+		Relations:      relations,
+		SoftDelete:     softDelete,
+		Version:        version,
+	}
+}
+
+func makeRelationInfo(f reflect.StructField, ti tagInfo, offset uintptr) RelationInfo {
+	if ti.foreignKey == "" {
+		panic("relation field " + f.Name + " requires a foreign key, e.g. `db:\"" + ti.relation + ":fk=foo_id\"`")
+	}
+	r := RelationInfo{
+		Name:       f.Name,
+		ForeignKey: ti.foreignKey,
+		Type:       f.Type,
+		Offset:     offset + f.Offset,
+	}
+	if ti.relation == "has_many" {
+		r.Kind = RelationHasMany
+		if f.Type.Kind() != reflect.Slice || f.Type.Elem().Kind() != reflect.Struct {
+			panic("has_many field " + f.Name + " must be a slice of structs")
+		}
+	} else {
+		r.Kind = RelationBelongsTo
+		if r.StructType().Kind() != reflect.Struct || f.Type.Kind() == reflect.Slice {
+			panic("belongs_to field " + f.Name + " must be a struct or a pointer to struct")
+		}
 	}
+	return r
 }
 
 func ScanStruct(t reflect.Type, offset uintptr, custom FieldInterfaceResolver) *StructInfo {
 	return scanStructImpl(t, &scanStructCtx{
 		offset: offset,
 		custom: custom,
+		naming: defaultNaming,
 	})
 }
@@ -0,0 +1,63 @@
+package sqlbatch
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// possibly qualified table name, database and schema are optional
+type tableName struct {
+	db     string
+	schema string
+	name   string
+}
+
+// Parses table name given as separate parts or as a single dot separated
+// string: "t", "s.t", "db.s.t", ("s", "t") or ("db", "s", "t").
+func parseTableName(parts ...string) tableName {
+	if len(parts) == 1 {
+		parts = strings.Split(parts[0], ".")
+	}
+	for _, p := range parts {
+		if p == "" {
+			panic("table name parts must not be empty")
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return tableName{name: parts[0]}
+	case 2:
+		return tableName{schema: parts[0], name: parts[1]}
+	case 3:
+		return tableName{db: parts[0], schema: parts[1], name: parts[2]}
+	}
+	panic("table name must have one to three parts: [database.][schema.]table")
+}
+
+// quotes each non-empty part separately and joins them with dots
+func quoteQualifiedName(parts ...string) string {
+	var sb strings.Builder
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		if sb.Len() != 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(pq.QuoteIdentifier(p))
+	}
+	return sb.String()
+}
+
+// quotes the table name, unqualified names get the default schema of the batch
+func (b *Batch) quoteTableName(t tableName) string {
+	if t.schema == "" && t.db == "" {
+		t.schema = b.defaultSchema
+	}
+	return quoteQualifiedName(t.db, t.schema, t.name)
+}
+
+func (si *StructInfo) tableName() tableName {
+	return tableName{schema: si.Schema, name: si.Name}
+}
@@ -11,7 +11,16 @@ type tagInfo struct {
 	group      string
 	isCreated  bool
 	isUpdated  bool
+	isDeleted  bool
+	isVersion  bool
 	isDefault  bool
+	readOnly   bool
+	insertOnly bool
+	noInsert   bool
+	relation   string // "has_many" or "belongs_to"
+	foreignKey string
+	table      string // struct-level, on a blank field
+	schema     string // struct-level, on a blank field
 }
 
 func parseTag(t string) (out tagInfo) {
@@ -36,8 +45,31 @@ func parseTag(t string) (out tagInfo) {
 				out.isCreated = true
 			case "updated":
 				out.isUpdated = true
+			case "deleted":
+				out.isDeleted = true
+			case "version":
+				out.isVersion = true
 			case "default":
 				out.isDefault = true
+			case "readonly":
+				out.readOnly = true
+			case "insertonly":
+				out.insertOnly = true
+			case "noinsert":
+				out.noInsert = true
+			case "schema":
+				if len(kv) > 1 {
+					out.schema = kv[1]
+				}
+			case "table":
+				if len(kv) > 1 {
+					out.table = kv[1]
+				}
+			case "has_many", "belongs_to":
+				out.relation = kv[0]
+				if len(kv) > 1 {
+					out.foreignKey = strings.TrimPrefix(kv[1], "fk=")
+				}
 			}
 		}
 	}
@@ -14,12 +14,20 @@ func TestTagParse(t *testing.T) {
 		{"primary_key", tagInfo{primaryKey: true}},
 		{"foo", tagInfo{}},
 		{"default", tagInfo{isDefault: true}},
+		{"readonly", tagInfo{readOnly: true}},
+		{"deleted", tagInfo{isDeleted: true}},
+		{"version", tagInfo{isVersion: true}},
+		{"insertonly,noinsert", tagInfo{insertOnly: true, noInsert: true}},
 		{"-", tagInfo{ignore: true}},
 		{"column:foo", tagInfo{name: "foo"}},
 		{"group:bar", tagInfo{group: "bar"}},
 		{"column:foo,primary_key", tagInfo{name: "foo", primaryKey: true}},
 		{"primary_key,column:foo", tagInfo{name: "foo", primaryKey: true}},
 		{"primary_key,column:foo,-", tagInfo{name: "foo", primaryKey: true, ignore: true}},
+		{"has_many:fk=order_id", tagInfo{relation: "has_many", foreignKey: "order_id"}},
+		{"belongs_to:fk=user_id", tagInfo{relation: "belongs_to", foreignKey: "user_id"}},
+		{"table:accounts", tagInfo{table: "accounts"}},
+		{"schema:app,table:accounts", tagInfo{schema: "app", table: "accounts"}},
 	}
 	for i, c := range cases {
 		t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
@@ -0,0 +1,77 @@
+package sqlbatch
+
+import (
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// UpdateChanged updates only the columns which differ between before and after,
+// both must be pointers to structs of the same type with equal primary keys.
+// Values are compared by their SQL representation. If nothing changed, no
+// statement is emitted.
+func (b *Batch) UpdateChanged(before, after any) *Batch {
+	return b.updateChanged(before, after, false)
+}
+
+// UpdateChangedGuarded is the same as UpdateChanged, but the before values of the
+// changed columns are added to the WHERE clause, so that the row is not
+// updated if somebody else has changed those columns in the meantime.
+func (b *Batch) UpdateChangedGuarded(before, after any) *Batch {
+	return b.updateChanged(before, after, true)
+}
+
+func (b *Batch) updateChanged(before, after any, guarded bool) *Batch {
+	oldVal, newVal := reflect.ValueOf(before), reflect.ValueOf(after)
+	t := assertPointerToStruct(newVal.Type())
+	if oldVal.Type() != newVal.Type() {
+		panic("before and after must be of the same type")
+	}
+	si := b.structInfo(t)
+	assertHasPrimaryKeys(si)
+	oldPtr, newPtr := unsafe.Pointer(oldVal.Pointer()), unsafe.Pointer(newVal.Pointer())
+
+	for _, f := range si.PrimaryKeys {
+		if fieldLiteral(f, oldPtr) != fieldLiteral(f, newPtr) {
+			panic("before and after must have the same primary key")
+		}
+	}
+
+	// old values of the changed fields
+	changed := map[*FieldInfo]string{}
+	for _, f := range si.NonPrimaryKeys {
+		if f.IsUpdated() || f.IsVersion() || !f.isUpdatable() {
+			continue
+		}
+		if oldLit := fieldLiteral(f, oldPtr); oldLit != fieldLiteral(f, newPtr) {
+			changed[f] = oldLit
+		}
+	}
+	if len(changed) == 0 {
+		return b
+	}
+
+	var guard func(sb *strings.Builder)
+	if guarded {
+		guard = func(sb *strings.Builder) {
+			for _, f := range si.NonPrimaryKeys {
+				oldLit, ok := changed[f]
+				if !ok {
+					continue
+				}
+				sb.WriteString(" AND ")
+				sb.WriteString(f.QuotedName)
+				if oldLit == "NULL" {
+					sb.WriteString(" IS NULL")
+				} else {
+					sb.WriteString(" = ")
+					sb.WriteString(oldLit)
+				}
+			}
+		}
+	}
+	return b.update(after, "", func(f *FieldInfo) bool {
+		_, ok := changed[f]
+		return ok
+	}, guard)
+}
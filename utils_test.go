@@ -66,3 +66,12 @@ func assertDeepEquals(t *testing.T, a, b any) {
 		t.Errorf("equality expected, got: %v != %v", a, b)
 	}
 }
+
+func assertPanics(t *testing.T, f func()) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("panic expected")
+		}
+	}()
+	f()
+}
@@ -0,0 +1,105 @@
+package sqlbatch
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// ErrStaleVersion is returned (wrapped in *StaleVersionError) by Run when an
+// update of a struct with a "version" field didn't match any row.
+var ErrStaleVersion = errors.New("stale version")
+
+type StaleVersionError struct {
+	// 1-based index of the statement in the batch
+	Statement int
+	Err       error
+}
+
+func (e *StaleVersionError) Error() string {
+	return "stale version in statement " + strconv.Itoa(e.Statement) + ": " + e.Err.Error()
+}
+
+func (e *StaleVersionError) Unwrap() error {
+	return ErrStaleVersion
+}
+
+// the database fails to cast the marker to INT when nothing was updated, the
+// error message contains the marker with the statement index
+const staleVersionMarker = "sqlbatch:stale_version:"
+
+func isVersionKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// version field of a struct updated by the batch, incremented after a
+// successful Run
+type versionBump struct {
+	f   *FieldInfo
+	ptr unsafe.Pointer
+}
+
+func (vb versionBump) value() reflect.Value {
+	return reflect.NewAt(vb.f.Type, unsafe.Pointer(uintptr(vb.ptr)+vb.f.Offset)).Elem()
+}
+
+// Writes the expected version of the struct, which includes the increments of
+// the preceding updates of the same struct in this batch.
+func (b *Batch) writeExpectedVersion(vb versionBump, sb *strings.Builder) {
+	n := vb.value().Int()
+	for _, pending := range b.versionBumps {
+		if pending == vb {
+			n++
+		}
+	}
+	sb.WriteString(strconv.FormatInt(n, 10))
+}
+
+func (b *Batch) applyVersionBumps() {
+	for _, vb := range b.versionBumps {
+		v := vb.value()
+		v.SetInt(v.Int() + 1)
+	}
+	b.versionBumps = nil
+}
+
+// Wraps the update of a versioned struct, statement fails if no rows were
+// updated:
+//
+//	WITH u AS (UPDATE ... RETURNING 1) SELECT CASE WHEN count(*) = 0 THEN CAST(<marker> AS INT) END FROM u
+//
+// count(*) is a part of the marker, so that it can't be evaluated in advance.
+func writeStaleVersionCheck(idx int, sb *strings.Builder) {
+	sb.WriteString(" RETURNING 1) SELECT CASE WHEN count(*) = 0 THEN CAST('")
+	sb.WriteString(staleVersionMarker)
+	sb.WriteString(strconv.Itoa(idx))
+	sb.WriteString(":' || count(*)::STRING AS INT) END FROM u")
+}
+
+// converts database errors caused by stale version checks into *StaleVersionError
+func staleVersionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	i := strings.Index(msg, staleVersionMarker)
+	if i == -1 {
+		return err
+	}
+	msg = msg[i+len(staleVersionMarker):]
+	end := strings.IndexByte(msg, ':')
+	if end == -1 {
+		return err
+	}
+	idx, convErr := strconv.Atoi(msg[:end])
+	if convErr != nil {
+		return err
+	}
+	return &StaleVersionError{Statement: idx, Err: err}
+}
@@ -0,0 +1,90 @@
+package sqlbatch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+type versionTestConn struct {
+	err error
+}
+
+func (c *versionTestConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, c.err
+}
+
+func (c *versionTestConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestVersion(t *testing.T) {
+	type Account struct {
+		ID        int64 `db:"primary_key"`
+		Balance   int64
+		Version   int32     `db:"version"`
+		UpdatedAt time.Time `db:"updated"`
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := &Account{ID: 1, Balance: 10, Version: 3}
+	b := New().SetTimeNowFunc(func() time.Time { return now })
+	b.Insert(v)
+	b.Update(v)
+	b.UpdateFields(v, "balance")
+	assertStringEquals(t, b.String(), `INSERT INTO "account" ("id", "balance", "version", "updated_at") VALUES (1, 10, 3, '2020-01-02 03:04:05') RETURNING NOTHING; `+
+		`WITH u AS (UPDATE "account" SET "balance" = 10, "updated_at" = '2020-01-02 03:04:05', "version" = "version" + 1 WHERE "id" = 1 AND "version" = 3 `+
+		`RETURNING 1) SELECT CASE WHEN count(*) = 0 THEN CAST('sqlbatch:stale_version:2:' || count(*)::STRING AS INT) END FROM u; `+
+		`WITH u AS (UPDATE "account" SET "balance" = 10, "updated_at" = '2020-01-02 03:04:05', "version" = "version" + 1 WHERE "id" = 1 AND "version" = 4 `+
+		`RETURNING 1) SELECT CASE WHEN count(*) = 0 THEN CAST('sqlbatch:stale_version:3:' || count(*)::STRING AS INT) END FROM u`)
+	// the struct is only updated by a successful Run
+	assertDeepEquals(t, v.Version, int32(3))
+	if err := b.Run(context.Background(), &versionTestConn{err: errors.New("conn error")}); err == nil {
+		t.Fatal("error expected")
+	}
+	assertDeepEquals(t, v.Version, int32(3))
+	if err := b.Run(context.Background(), &versionTestConn{}); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEquals(t, v.Version, int32(5))
+
+	before := *v
+	b = New()
+	b.UpdateChanged(&before, v)
+	assertStringEquals(t, b.String(), ``)
+
+	b = New().SetTimeNowFunc(func() time.Time { return now })
+	b.UpdateWhere(b.QueryBuilder().TableFromStruct(v).Where("balance < ?", 0), Set("balance", 0))
+	assertStringEquals(t, b.String(), `UPDATE "account" SET "balance" = 0, "updated_at" = '2020-01-02 03:04:05', "version" = "version" + 1 WHERE balance < 0`)
+
+	assertPanics(t, func() {
+		New().UpdateFields(v, "version")
+	})
+	assertPanics(t, func() {
+		b := New()
+		b.UpdateWhere(b.QueryBuilder().TableFromStruct(v), Set("version", 1))
+	})
+}
+
+func TestStaleVersionError(t *testing.T) {
+	type Doc struct {
+		ID      int64 `db:"primary_key"`
+		Version int64 `db:"version"`
+	}
+	b := New()
+	b.Update(&Doc{ID: 1})
+	conn := &versionTestConn{err: errors.New(`pq: could not parse "sqlbatch:stale_version:1:0" as type int`)}
+	err := b.Run(context.Background(), conn)
+	if !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("ErrStaleVersion expected, got: %v", err)
+	}
+	var sve *StaleVersionError
+	if !errors.As(err, &sve) {
+		t.Fatalf("*StaleVersionError expected, got: %T", err)
+	}
+	assertDeepEquals(t, sve.Statement, 1)
+
+	other := errors.New("connection refused")
+	assertDeepEquals(t, staleVersionError(other), other)
+}